@@ -0,0 +1,208 @@
+package main
+
+import (
+	"sort"
+	"unsafe"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// BatchRenderer draws the meshes of a pool with as few draw calls as possible. Draws are queued with their model matrix
+// and sorted by material, and every material is drawn with a single glMultiDrawElementsIndirect whose commands and matrices
+// come from buffers. Without OpenGL 4.3 or ARB_multi_draw_indirect, it falls back to one DrawElementsBaseVertex per submesh
+type BatchRenderer struct {
+	pool     *MeshPool
+	indirect bool
+	commands uint32
+	// The model matrix of every command, read through the instance attributes from the base instance of the command
+	instances InstanceBuffer
+
+	draws   []batchDraw
+	batches []batch
+	// Whether draws were queued since the commands were uploaded
+	dirty bool
+	// The generation of the pool when the commands were uploaded
+	generation int
+}
+
+// batchDraw is a queued submesh of a pooled mesh
+type batchDraw struct {
+	mesh    *PooledMesh
+	submesh Submesh
+	matrix  mgl32.Mat4
+}
+
+// batch is a range of sorted draws with the same material and primitive mode
+type batch struct {
+	material     *Material
+	mode         PrimitiveMode
+	first, count int
+}
+
+// drawElementsIndirectCommand is the layout of a command of glMultiDrawElementsIndirect
+type drawElementsIndirectCommand struct {
+	count         uint32
+	instanceCount uint32
+	firstIndex    uint32
+	baseVertex    int32
+	baseInstance  uint32
+}
+
+// NewBatchRenderer creates a renderer for the meshes of the pool
+func NewBatchRenderer(pool *MeshPool) *BatchRenderer {
+	r := &BatchRenderer{pool: pool, indirect: multiDrawIndirectSupported()}
+	if r.indirect {
+		gl.GenBuffers(1, &r.commands)
+		r.instances = NewInstanceBuffer()
+	}
+	return r
+}
+
+// multiDrawIndirectSupported checks if the context supports indirect draws with a base instance
+func multiDrawIndirectSupported() bool {
+	return glSupported(4, 3, "GL_ARB_multi_draw_indirect", "GL_ARB_base_instance")
+}
+
+// Indirect returns whether the renderer uses glMultiDrawElementsIndirect instead of the fallback
+func (r *BatchRenderer) Indirect() bool {
+	return r.indirect
+}
+
+// Add queues all parts of the mesh that are not hidden with the model matrix
+func (r *BatchRenderer) Add(mesh *PooledMesh, matrix mgl32.Mat4) {
+	for i := range mesh.parts {
+		if !mesh.parts[i].hidden {
+			r.AddPart(mesh, &mesh.parts[i], matrix)
+		}
+	}
+}
+
+// AddPart queues a single part of the mesh with the model matrix, even if it is hidden. Meshes that are not part of the
+// pool of the renderer are ignored
+func (r *BatchRenderer) AddPart(mesh *PooledMesh, part *ModelPart, matrix mgl32.Mat4) {
+	if mesh.pool != r.pool {
+		return
+	}
+	for _, s := range part.submeshes {
+		r.draws = append(r.draws, batchDraw{mesh, s, matrix})
+	}
+	r.dirty = true
+}
+
+// AddEntity queues the mesh with the world transform of the entity
+func (r *BatchRenderer) AddEntity(mesh *PooledMesh, entity *Entity) {
+	r.Add(mesh, entity.ModelMatrix())
+}
+
+// Clear removes all queued draws. The same draws can be drawn every frame without clearing and queueing them again
+func (r *BatchRenderer) Clear() {
+	r.draws = r.draws[:0]
+	r.dirty = true
+}
+
+// Draw draws all queued draws. The shader should be already bound
+func (r *BatchRenderer) Draw(shader *ShaderProgram) {
+	if r.dirty || r.generation != r.pool.generation {
+		r.prepare()
+	}
+	if len(r.draws) == 0 {
+		return
+	}
+	r.pool.Bind()
+	if r.indirect {
+		r.instances.bind(shader)
+		gl.BindBuffer(gl.DRAW_INDIRECT_BUFFER, r.commands)
+	}
+	commandSize := int(unsafe.Sizeof(drawElementsIndirectCommand{}))
+	for _, b := range r.batches {
+		if b.material != nil {
+			b.material.Bind(shader)
+		} else {
+			loadDefaultMaterial(shader, false)
+		}
+		if r.indirect {
+			gl.MultiDrawElementsIndirect(b.mode.glMode(), gl.UNSIGNED_INT, gl.PtrOffset(b.first*commandSize), int32(b.count), 0)
+		} else {
+			for _, d := range r.draws[b.first : b.first+b.count] {
+				shader.LoadUniformMatrix("modelMatrix", d.matrix)
+				gl.DrawElementsBaseVertex(b.mode.glMode(), d.submesh.count, gl.UNSIGNED_INT, gl.PtrOffset(int(d.submesh.offset)*poolIndexSize), d.mesh.firstVertex)
+			}
+		}
+		if b.material != nil {
+			b.material.Unbind(shader)
+		}
+	}
+	if r.indirect {
+		gl.BindBuffer(gl.DRAW_INDIRECT_BUFFER, 0)
+		r.instances.unbind(shader)
+	}
+	r.pool.Unbind()
+}
+
+// prepare sorts the draws into batches and uploads their commands and matrices
+func (r *BatchRenderer) prepare() {
+	r.dirty = false
+	// Draws of removed meshes are dropped, since their ranges may belong to other meshes by now
+	if r.generation != r.pool.generation {
+		r.generation = r.pool.generation
+		draws := r.draws[:0]
+		for _, d := range r.draws {
+			if d.mesh.pool == r.pool {
+				draws = append(draws, d)
+			}
+		}
+		r.draws = draws
+	}
+	// Materials have no order of their own, so the draws are grouped by the order in which the materials were first queued
+	order := map[*Material]int{}
+	for _, d := range r.draws {
+		if _, ok := order[d.submesh.material]; !ok {
+			order[d.submesh.material] = len(order)
+		}
+	}
+	sort.SliceStable(r.draws, func(i, j int) bool {
+		a, b := r.draws[i].submesh, r.draws[j].submesh
+		if order[a.material] != order[b.material] {
+			return order[a.material] < order[b.material]
+		}
+		return a.mode < b.mode
+	})
+
+	r.batches = r.batches[:0]
+	for i, d := range r.draws {
+		if n := len(r.batches); n > 0 && r.batches[n-1].material == d.submesh.material && r.batches[n-1].mode == d.submesh.mode {
+			r.batches[n-1].count++
+			continue
+		}
+		r.batches = append(r.batches, batch{material: d.submesh.material, mode: d.submesh.mode, first: i, count: 1})
+	}
+	if !r.indirect || len(r.draws) == 0 {
+		return
+	}
+
+	commands := make([]drawElementsIndirectCommand, len(r.draws))
+	matrices := make([]mgl32.Mat4, len(r.draws))
+	for i, d := range r.draws {
+		commands[i] = drawElementsIndirectCommand{
+			count:         uint32(d.submesh.count),
+			instanceCount: 1,
+			firstIndex:    uint32(d.submesh.offset),
+			baseVertex:    d.mesh.firstVertex,
+			baseInstance:  uint32(i),
+		}
+		matrices[i] = d.matrix
+	}
+	gl.BindBuffer(gl.DRAW_INDIRECT_BUFFER, r.commands)
+	gl.BufferData(gl.DRAW_INDIRECT_BUFFER, len(commands)*int(unsafe.Sizeof(commands[0])), gl.Ptr(commands), gl.DYNAMIC_DRAW)
+	gl.BindBuffer(gl.DRAW_INDIRECT_BUFFER, 0)
+	r.instances.SetInstances(matrices, nil)
+}
+
+// Delete deletes the buffers of the renderer. The pool is not deleted
+func (r *BatchRenderer) Delete() {
+	if r.indirect {
+		gl.DeleteBuffers(1, &r.commands)
+		r.instances.Delete()
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestBatchRendererDropsRemovedMeshes(t *testing.T) {
+	pool := &MeshPool{}
+	pool.freeVertices.grow(8)
+	pool.freeIndices.grow(12)
+	meshes := make([]*PooledMesh, 2)
+	for i := range meshes {
+		meshes[i] = &PooledMesh{pool: pool, firstVertex: int32(4 * i), vertexCount: 4, firstIndex: int32(6 * i), indexCount: 6,
+			parts: []ModelPart{{submeshes: []Submesh{{offset: int32(6 * i), count: 6}}}}}
+		pool.freeVertices.allocate(4)
+		pool.freeIndices.allocate(6)
+	}
+	// The renderer uses the fallback, which needs no buffers
+	r := &BatchRenderer{pool: pool}
+	r.Add(meshes[0], mgl32.Ident4())
+	r.Add(meshes[1], mgl32.Ident4())
+	r.prepare()
+	if len(r.draws) != 2 {
+		t.Fatalf("%d draws instead of 2", len(r.draws))
+	}
+
+	if err := pool.Remove(meshes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Remove(meshes[0]); err == nil {
+		t.Fatal("Expected an error for removing a mesh twice")
+	}
+	r.prepare()
+	if len(r.draws) != 1 || r.draws[0].mesh != meshes[1] || len(r.batches) != 1 || r.batches[0].count != 1 {
+		t.Fatalf("Draws %+v, batches %+v", r.draws, r.batches)
+	}
+	// A removed mesh that is queued again is not drawn either
+	r.Add(meshes[0], mgl32.Ident4())
+	if len(r.draws) != 1 {
+		t.Fatalf("%d draws instead of 1", len(r.draws))
+	}
+}
+
+func TestMeshPoolRejectsPatches(t *testing.T) {
+	mesh := Mesh{positions: []float32{0, 0, 0, 1, 0, 0, 0, 1, 0}, indices: []uint32{0, 1, 2},
+		parts: []ModelPart{{submeshes: []Submesh{{count: 3, mode: PrimitivePatches}}}}}
+	if _, err := (&MeshPool{}).Add(&mesh); err == nil {
+		t.Fatal("Expected an error for patches")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// AABB is an axis-aligned bounding box. The zero value is the empty box at the origin
+type AABB struct {
+	min mgl32.Vec3
+	max mgl32.Vec3
+}
+
+// BoundingSphere is a sphere that contains all vertices of a model
+type BoundingSphere struct {
+	center mgl32.Vec3
+	radius float32
+}
+
+// computeAABB returns the bounding box of the xyz positions
+func computeAABB(positions []float32) AABB {
+	if len(positions) < 3 {
+		return AABB{}
+	}
+	box := AABB{mgl32.Vec3{positions[0], positions[1], positions[2]}, mgl32.Vec3{positions[0], positions[1], positions[2]}}
+	for i := 3; i+2 < len(positions); i += 3 {
+		for j := 0; j < 3; j++ {
+			box.min[j] = float32(math.Min(float64(box.min[j]), float64(positions[i+j])))
+			box.max[j] = float32(math.Max(float64(box.max[j]), float64(positions[i+j])))
+		}
+	}
+	return box
+}
+
+// Min returns the corner of the box with the smallest coordinates
+func (b AABB) Min() mgl32.Vec3 {
+	return b.min
+}
+
+// Max returns the corner of the box with the largest coordinates
+func (b AABB) Max() mgl32.Vec3 {
+	return b.max
+}
+
+// Center returns the center of the box
+func (b AABB) Center() mgl32.Vec3 {
+	return b.min.Add(b.max).Mul(0.5)
+}
+
+// Size returns the extent of the box along every axis
+func (b AABB) Size() mgl32.Vec3 {
+	return b.max.Sub(b.min)
+}
+
+// Contains checks if the point is inside the box or on its surface
+func (b AABB) Contains(p mgl32.Vec3) bool {
+	return p.X() >= b.min.X() && p.Y() >= b.min.Y() && p.Z() >= b.min.Z() &&
+		p.X() <= b.max.X() && p.Y() <= b.max.Y() && p.Z() <= b.max.Z()
+}
+
+// Transform returns the axis-aligned box that contains this box after the transformation,
+// using Arvo's method of adding up the extents of the transformed axes
+func (b AABB) Transform(matrix mgl32.Mat4) AABB {
+	translation := matrix.Col(3).Vec3()
+	result := AABB{translation, translation}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			e := matrix.At(i, j) * b.min[j]
+			f := matrix.At(i, j) * b.max[j]
+			if e < f {
+				result.min[i] += e
+				result.max[i] += f
+			} else {
+				result.min[i] += f
+				result.max[i] += e
+			}
+		}
+	}
+	return result
+}
+
+// computeBoundingSphere returns a sphere around the xyz positions with Ritter's algorithm, which is at most a few percent
+// larger than the smallest sphere
+func computeBoundingSphere(positions []float32) BoundingSphere {
+	count := len(positions) / 3
+	if count == 0 {
+		return BoundingSphere{}
+	}
+	position := func(i int) mgl32.Vec3 {
+		return mgl32.Vec3{positions[3*i], positions[3*i+1], positions[3*i+2]}
+	}
+	farthest := func(from mgl32.Vec3) mgl32.Vec3 {
+		result := from
+		distance := float32(-1)
+		for i := 0; i < count; i++ {
+			if d := position(i).Sub(from).Len(); d > distance {
+				result, distance = position(i), d
+			}
+		}
+		return result
+	}
+
+	// The initial sphere is spanned by two points that are far apart and grows to include all other points
+	a := farthest(position(0))
+	b := farthest(a)
+	sphere := BoundingSphere{a.Add(b).Mul(0.5), b.Sub(a).Len() / 2}
+	for i := 0; i < count; i++ {
+		p := position(i)
+		if d := p.Sub(sphere.center).Len(); d > sphere.radius {
+			radius := (sphere.radius + d) / 2
+			sphere.center = sphere.center.Add(p.Sub(sphere.center).Mul((radius - sphere.radius) / d))
+			sphere.radius = radius
+		}
+	}
+	return sphere
+}
+
+// Center returns the center of the sphere
+func (s BoundingSphere) Center() mgl32.Vec3 {
+	return s.center
+}
+
+// Radius returns the radius of the sphere
+func (s BoundingSphere) Radius() float32 {
+	return s.radius
+}
+
+// Transform returns the sphere that contains this sphere after the transformation. Non-uniform scales grow the radius
+// by the largest scale
+func (s BoundingSphere) Transform(matrix mgl32.Mat4) BoundingSphere {
+	return BoundingSphere{
+		center: mgl32.TransformCoordinate(s.center, matrix),
+		radius: s.radius * matrixScale(matrix),
+	}
+}
+
+// matrixScale returns the largest scale of the axes of the matrix
+func matrixScale(matrix mgl32.Mat4) float32 {
+	scale := float32(0)
+	for i := 0; i < 3; i++ {
+		scale = float32(math.Max(float64(scale), float64(matrix.Col(i).Vec3().Len())))
+	}
+	return scale
+}
+
+// computeBounds computes the bounding volumes of the model from its xyz positions
+func (m *Model) computeBounds(positions []float32) {
+	m.bounds = computeAABB(positions)
+	m.sphere = computeBoundingSphere(positions)
+}
+
+// Bounds returns the bounding box of the model in model space
+func (m *Model) Bounds() AABB {
+	return m.bounds
+}
+
+// BoundingSphere returns the bounding sphere of the model in model space
+func (m *Model) BoundingSphere() BoundingSphere {
+	return m.sphere
+}
+
+// WorldBounds returns the bounding box of the model of the entity in world space. Entities without a model have an empty box at their position
+func (e *Entity) WorldBounds() AABB {
+	if e.model == nil {
+		return AABB{}.Transform(e.ModelMatrix())
+	}
+	return e.model.bounds.Transform(e.ModelMatrix())
+}
+
+// WorldBoundingSphere returns the bounding sphere of the model of the entity in world space
+func (e *Entity) WorldBoundingSphere() BoundingSphere {
+	if e.model == nil {
+		return BoundingSphere{}.Transform(e.ModelMatrix())
+	}
+	return e.model.sphere.Transform(e.ModelMatrix())
+}
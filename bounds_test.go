@@ -0,0 +1,141 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// testIsFinite checks that no component of the vector is NaN or infinite
+func testIsFinite(v mgl32.Vec3) bool {
+	for _, c := range v {
+		if math.IsNaN(float64(c)) || math.IsInf(float64(c), 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAABBTransform(t *testing.T) {
+	box := AABB{mgl32.Vec3{-1, -2, -3}, mgl32.Vec3{2, 1, 4}}
+	tests := []struct {
+		name   string
+		matrix mgl32.Mat4
+	}{
+		{"identity", mgl32.Ident4()},
+		{"translated", mgl32.Translate3D(5, -6, 7)},
+		{"rotated", mgl32.HomogRotate3D(mgl32.DegToRad(30), mgl32.Vec3{1, 2, 3}.Normalize())},
+		{"scaled", mgl32.Scale3D(2, 0.5, 3)},
+		{"mirrored", mgl32.Scale3D(-1, 1, 1)},
+		{"combined", mgl32.Translate3D(1, 2, 3).Mul4(mgl32.HomogRotate3DY(mgl32.DegToRad(45))).Mul4(mgl32.Scale3D(2, 1, 3))},
+	}
+	for _, test := range tests {
+		result := box.Transform(test.matrix)
+		// The transformed box is the smallest box around the transformed corners
+		expected := AABB{}
+		for i := 0; i < 8; i++ {
+			corner := box.min
+			for j := 0; j < 3; j++ {
+				if i&(1<<j) != 0 {
+					corner[j] = box.max[j]
+				}
+			}
+			p := mgl32.TransformCoordinate(corner, test.matrix)
+			if i == 0 {
+				expected = AABB{p, p}
+			}
+			for j := 0; j < 3; j++ {
+				expected.min[j] = float32(math.Min(float64(expected.min[j]), float64(p[j])))
+				expected.max[j] = float32(math.Max(float64(expected.max[j]), float64(p[j])))
+			}
+		}
+		if !testVecNear(result.min, expected.min) || !testVecNear(result.max, expected.max) {
+			t.Errorf("%s: expected %v, got %v", test.name, expected, result)
+		}
+	}
+}
+
+func TestComputeAABB(t *testing.T) {
+	if box := computeAABB(nil); box != (AABB{}) {
+		t.Errorf("Expected the empty box for no positions, got %v", box)
+	}
+	if box := computeAABB([]float32{1, 2, 3}); box.Min() != (mgl32.Vec3{1, 2, 3}) || box.Max() != (mgl32.Vec3{1, 2, 3}) {
+		t.Errorf("Expected a box without extent for a single point, got %v", box)
+	}
+	box := computeAABB([]float32{1, 2, 3, -1, 5, 0, 0, 0, 4})
+	if box.Min() != (mgl32.Vec3{-1, 0, 0}) || box.Max() != (mgl32.Vec3{1, 5, 4}) || box.Size() != (mgl32.Vec3{2, 5, 4}) {
+		t.Errorf("Unexpected box %v", box)
+	}
+}
+
+func TestComputeBoundingSphere(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	clouds := map[string][]float32{"grid": testSeamGrid(10).positions}
+	random := []float32{}
+	for i := 0; i < 3000; i++ {
+		random = append(random, r.Float32()*4-2, r.Float32()*2-1, r.Float32()*6)
+	}
+	clouds["random"] = random
+	for name, positions := range clouds {
+		sphere := computeBoundingSphere(positions)
+		for i := 0; i < len(positions); i += 3 {
+			p := mgl32.Vec3{positions[i], positions[i+1], positions[i+2]}
+			if d := p.Sub(sphere.Center()).Len(); d > sphere.Radius()*(1+1e-5) {
+				t.Fatalf("%s: point %v is %v from the center, outside the radius %v", name, p, d, sphere.Radius())
+			}
+		}
+		// The smallest sphere is at most as large as the sphere around the bounding box
+		if limit := computeAABB(positions).Size().Len() / 2 * 1.1; sphere.Radius() > limit {
+			t.Errorf("%s: radius %v is much larger than the sphere around the bounding box", name, sphere.Radius())
+		}
+	}
+}
+
+func TestComputeBoundingSphereDegenerate(t *testing.T) {
+	tests := []struct {
+		name      string
+		positions []float32
+		center    mgl32.Vec3
+	}{
+		{"empty", nil, mgl32.Vec3{}},
+		{"single point", []float32{1, 2, 3}, mgl32.Vec3{1, 2, 3}},
+		{"equal points", []float32{1, 2, 3, 1, 2, 3, 1, 2, 3}, mgl32.Vec3{1, 2, 3}},
+	}
+	for _, test := range tests {
+		sphere := computeBoundingSphere(test.positions)
+		if !testIsFinite(sphere.Center()) || sphere.Center() != test.center || sphere.Radius() != 0 {
+			t.Errorf("%s: expected a sphere without radius at %v, got %v", test.name, test.center, sphere)
+		}
+		transformed := sphere.Transform(mgl32.Translate3D(1, 1, 1).Mul4(mgl32.Scale3D(2, 2, 2)))
+		if !testIsFinite(transformed.Center()) || math.IsNaN(float64(transformed.Radius())) {
+			t.Errorf("%s: the transformed sphere is %v", test.name, transformed)
+		}
+	}
+}
+
+func TestBoundingSphereTransform(t *testing.T) {
+	sphere := BoundingSphere{mgl32.Vec3{1, 0, 0}, 2}
+	matrix := mgl32.Translate3D(0, 5, 0).Mul4(mgl32.HomogRotate3DZ(mgl32.DegToRad(90))).Mul4(mgl32.Scale3D(1, 3, 2))
+	result := sphere.Transform(matrix)
+	// Non-uniform scales use the largest scale
+	if !testVecNear(result.Center(), mgl32.Vec3{0, 6, 0}) || math.Abs(float64(result.Radius()-6)) > 1e-5 {
+		t.Errorf("Expected a sphere with radius 6 at (0, 6, 0), got %v", result)
+	}
+}
+
+func TestEntityWorldBounds(t *testing.T) {
+	model := Model{bounds: AABB{mgl32.Vec3{-1, -1, -1}, mgl32.Vec3{1, 1, 1}}, sphere: BoundingSphere{radius: float32(math.Sqrt(3))}}
+	entity := Entity{position: mgl32.Vec3{5, 0, 0}, scale: mgl32.Vec3{2, 2, 2}, model: &model}
+	if bounds := entity.WorldBounds(); !testVecNear(bounds.Min(), mgl32.Vec3{3, -2, -2}) || !testVecNear(bounds.Max(), mgl32.Vec3{7, 2, 2}) {
+		t.Errorf("Unexpected world bounds %v", bounds)
+	}
+	if sphere := entity.WorldBoundingSphere(); !testVecNear(sphere.Center(), mgl32.Vec3{5, 0, 0}) || math.Abs(float64(sphere.Radius())-2*math.Sqrt(3)) > 1e-5 {
+		t.Errorf("Unexpected world bounding sphere %v", sphere)
+	}
+	empty := Entity{position: mgl32.Vec3{1, 2, 3}, scale: mgl32.Vec3{1, 1, 1}}
+	if bounds := empty.WorldBounds(); bounds.Min() != (mgl32.Vec3{1, 2, 3}) || bounds.Max() != (mgl32.Vec3{1, 2, 3}) {
+		t.Errorf("Expected an empty box at the position of an entity without a model, got %v", bounds)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// BufferUsage tells OpenGL how often the data of a buffer changes, so it can place the buffer in suitable memory
+type BufferUsage uint32
+
+// The usages of buffers. Static buffers are set once, dynamic buffers are updated from time to time
+// and stream buffers are replaced about every frame
+const (
+	StaticBuffer  BufferUsage = gl.STATIC_DRAW
+	DynamicBuffer BufferUsage = gl.DYNAMIC_DRAW
+	StreamBuffer  BufferUsage = gl.STREAM_DRAW
+)
+
+// vertexBuffer is the size in bytes and usage of a vertex buffer of a model. Interleaved buffers hold packed vertices
+// of a VertexLayout instead of floats
+type vertexBuffer struct {
+	size        int
+	usage       BufferUsage
+	interleaved bool
+}
+
+// AddBufferWithUsage adds a buffer containing the provided data and a vertex attribute with the given location like
+// AddBufferAndAttributeAt, but with the given usage. It returns the index of the buffer for updates
+func (m *Model) AddBufferWithUsage(location uint32, data []float32, numComponents int32, normalize bool, usage BufferUsage) int {
+	gl.BindVertexArray(m.vao)
+	var vbo uint32
+	gl.GenBuffers(1, &vbo)
+	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
+	gl.BufferData(gl.ARRAY_BUFFER, len(data)*4, gl.Ptr(data), uint32(usage))
+	gl.VertexAttribPointer(location, numComponents, gl.FLOAT, normalize, 0, nil)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	gl.BindVertexArray(0)
+	m.vbos = append(m.vbos, vbo)
+	m.buffers = append(m.buffers, vertexBuffer{len(data) * 4, usage, false})
+	m.locations = append(m.locations, location)
+	return len(m.vbos) - 1
+}
+
+// checkFloatBuffer returns an error if the buffer does not exist or is an interleaved buffer, whose vertices aren't floats
+func (m *Model) checkFloatBuffer(buffer int) error {
+	if buffer < 0 || buffer >= len(m.vbos) {
+		return fmt.Errorf("Invalid buffer %d", buffer)
+	}
+	if m.buffers[buffer].interleaved {
+		return fmt.Errorf("Buffer %d is interleaved and can't be updated with floats", buffer)
+	}
+	return nil
+}
+
+// UpdateBuffer overwrites the data of a buffer from the given offset in floats on without reallocating it.
+// The range must be inside of the buffer. Interleaved buffers can't be updated
+func (m *Model) UpdateBuffer(buffer int, offset int, data []float32) error {
+	if err := m.checkFloatBuffer(buffer); err != nil {
+		return err
+	}
+	if offset < 0 || (offset+len(data))*4 > m.buffers[buffer].size {
+		return fmt.Errorf("Update of %d floats at %d is outside of buffer %d", len(data), offset, buffer)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, m.vbos[buffer])
+	gl.BufferSubData(gl.ARRAY_BUFFER, offset*4, len(data)*4, gl.Ptr(data))
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	return nil
+}
+
+// ReplaceBuffer replaces all data of a buffer, which may change its size. The old storage is orphaned,
+// so the update doesn't wait for draw calls that still read it. Interleaved buffers can't be replaced
+func (m *Model) ReplaceBuffer(buffer int, data []float32) error {
+	if err := m.checkFloatBuffer(buffer); err != nil {
+		return err
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, m.vbos[buffer])
+	gl.BufferData(gl.ARRAY_BUFFER, len(data)*4, nil, uint32(m.buffers[buffer].usage))
+	if len(data) > 0 {
+		gl.BufferSubData(gl.ARRAY_BUFFER, 0, len(data)*4, gl.Ptr(data))
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	m.buffers[buffer].size = len(data) * 4
+	return nil
+}
+
+// ReplaceIndices replaces the index buffer of a model without parts or levels of detail, orphaning the old storage like ReplaceBuffer.
+// The type of the indices follows the largest index like in SetIndexBuffer
+func (m *Model) ReplaceIndices(indices []uint32) error {
+	// The parts and levels of detail point into the old indices
+	if len(m.parts) > 0 || len(m.lods) > 0 {
+		return errors.New("The indices of a model with parts or levels of detail can't be replaced")
+	}
+	data, indexType, indexSize := packIndices(indices)
+	// The index buffer binding is part of the bound VAO, so the VAO of the model is bound first like in SetIndexBuffer
+	gl.BindVertexArray(m.vao)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, m.indices)
+	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(indices)*indexSize, nil, gl.DYNAMIC_DRAW)
+	if len(indices) > 0 {
+		gl.BufferSubData(gl.ELEMENT_ARRAY_BUFFER, 0, len(indices)*indexSize, data)
+	}
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, 0)
+	gl.BindVertexArray(0)
+	m.size = int32(len(indices))
+	m.indexType, m.indexSize = indexType, indexSize
+	return nil
+}
+
+// ErrBufferStorageUnsupported is returned when creating a ring buffer without OpenGL 4.4 or ARB_buffer_storage
+var ErrBufferStorageUnsupported = errors.New("Persistent buffers need OpenGL 4.4 or ARB_buffer_storage")
+
+// How long to wait for the GPU to release a region of a ring buffer in nanoseconds before giving up
+const ringBufferTimeout = 1000 * 1000 * 1000
+
+// RingBuffer is a persistently mapped buffer that is split into regions, one for every frame in flight. Every frame writes
+// the next region while the GPU still reads the previous ones, and a fence makes sure a region is only written again
+// once the GPU is done with it. This avoids both reallocations and synchronization for data that changes every frame
+type RingBuffer struct {
+	vbo     uint32
+	mapped  []float32
+	regions int
+	// The number of floats per region
+	regionSize int
+	current    int
+	fences     []uintptr
+}
+
+// ringAttribute is a vertex attribute of a model that reads the current region of a ring buffer
+type ringAttribute struct {
+	ring          *RingBuffer
+	location      uint32
+	numComponents int32
+	normalize     bool
+}
+
+// NewRingBuffer creates a ring buffer with the given number of regions, each with room for regionSize floats.
+// Three regions are enough for the usual double or triple buffering of the driver
+func NewRingBuffer(regionSize, regions int) (*RingBuffer, error) {
+	if !bufferStorageSupported() {
+		return nil, ErrBufferStorageUnsupported
+	}
+	if regionSize <= 0 || regions <= 0 {
+		return nil, fmt.Errorf("Invalid ring buffer size %d x %d", regions, regionSize)
+	}
+	r := &RingBuffer{regions: regions, regionSize: regionSize, current: regions - 1, fences: make([]uintptr, regions)}
+	size := regionSize * regions * 4
+	flags := uint32(gl.MAP_WRITE_BIT | gl.MAP_PERSISTENT_BIT | gl.MAP_COHERENT_BIT)
+	gl.GenBuffers(1, &r.vbo)
+	gl.BindBuffer(gl.ARRAY_BUFFER, r.vbo)
+	gl.BufferStorage(gl.ARRAY_BUFFER, size, nil, flags)
+	pointer := gl.MapBufferRange(gl.ARRAY_BUFFER, 0, size, flags)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	if pointer == nil {
+		gl.DeleteBuffers(1, &r.vbo)
+		return nil, errors.New("Could not map the ring buffer")
+	}
+	r.mapped = unsafe.Slice((*float32)(pointer), regionSize*regions)
+	return r, nil
+}
+
+// Write moves to the next region, waits until the GPU is done with it and copies the data into it.
+// Attributes of models that use the ring buffer read this region from the next Bind on
+func (r *RingBuffer) Write(data []float32) error {
+	if len(data) > r.regionSize {
+		return fmt.Errorf("Data of %d floats does not fit into a ring buffer region of %d", len(data), r.regionSize)
+	}
+	next := (r.current + 1) % r.regions
+	if err := r.wait(next); err != nil {
+		return err
+	}
+	r.current = next
+	copy(r.mapped[next*r.regionSize:], data)
+	return nil
+}
+
+// Fence marks the current region as used by the draw calls issued so far. Call it after the last draw call that reads
+// the region, usually once per frame
+func (r *RingBuffer) Fence() {
+	if r.fences[r.current] != 0 {
+		gl.DeleteSync(r.fences[r.current])
+	}
+	r.fences[r.current] = gl.FenceSync(gl.SYNC_GPU_COMMANDS_COMPLETE, 0)
+}
+
+// wait waits until the fence of the region is signaled
+func (r *RingBuffer) wait(region int) error {
+	fence := r.fences[region]
+	if fence == 0 {
+		return nil
+	}
+	switch gl.ClientWaitSync(fence, gl.SYNC_FLUSH_COMMANDS_BIT, ringBufferTimeout) {
+	case gl.WAIT_FAILED:
+		return errors.New("Waiting for a ring buffer region failed")
+	case gl.TIMEOUT_EXPIRED:
+		return errors.New("Timeout while waiting for a ring buffer region")
+	}
+	gl.DeleteSync(fence)
+	r.fences[region] = 0
+	return nil
+}
+
+// offset returns the offset of the current region in bytes
+func (r *RingBuffer) offset() int {
+	return r.current * r.regionSize * 4
+}
+
+// Delete unmaps and deletes the buffer
+func (r *RingBuffer) Delete() {
+	for _, fence := range r.fences {
+		if fence != 0 {
+			gl.DeleteSync(fence)
+		}
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, r.vbo)
+	gl.UnmapBuffer(gl.ARRAY_BUFFER)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	gl.DeleteBuffers(1, &r.vbo)
+	r.mapped = nil
+}
+
+// AddRingBufferAttribute adds a vertex attribute with the given location that reads the current region of the ring buffer.
+// The ring buffer is not owned by the model and must be deleted separately
+func (m *Model) AddRingBufferAttribute(ring *RingBuffer, location uint32, numComponents int32, normalize bool) {
+	m.rings = append(m.rings, ringAttribute{ring, location, numComponents, normalize})
+	m.locations = append(m.locations, location)
+}
+
+// bindRings points the ring buffer attributes to the current regions of their buffers. The VAO must be bound
+func (m *Model) bindRings() {
+	for _, a := range m.rings {
+		gl.BindBuffer(gl.ARRAY_BUFFER, a.ring.vbo)
+		gl.VertexAttribPointer(a.location, a.numComponents, gl.FLOAT, a.normalize, 0, gl.PtrOffset(a.ring.offset()))
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
+
+// bufferStorageSupported checks if the context supports immutable buffers that can be mapped persistently
+func bufferStorageSupported() bool {
+	return glSupported(4, 4, "GL_ARB_buffer_storage")
+}
+
+// glSupported checks if the context has at least the given OpenGL version or else all of the extensions
+func glSupported(major, minor int32, extensions ...string) bool {
+	var contextMajor, contextMinor int32
+	gl.GetIntegerv(gl.MAJOR_VERSION, &contextMajor)
+	gl.GetIntegerv(gl.MINOR_VERSION, &contextMinor)
+	if contextMajor > major || contextMajor == major && contextMinor >= minor {
+		return true
+	}
+	var count int32
+	gl.GetIntegerv(gl.NUM_EXTENSIONS, &count)
+	found := 0
+	for i := int32(0); i < count; i++ {
+		name := gl.GoStr(gl.GetStringi(gl.EXTENSIONS, uint32(i)))
+		for _, extension := range extensions {
+			if name == extension {
+				found++
+			}
+		}
+	}
+	return found == len(extensions)
+}
@@ -1,24 +1,70 @@
 package main
 
 import (
+	"math"
+
 	"github.com/go-gl/mathgl/mgl32"
 )
 
-// Entity represents an entity in the game world
+// Entity represents an entity in the game world. The transform of an entity is relative to its parent if it has one
 type Entity struct {
 	position mgl32.Vec3
 	rotation mgl32.Vec3
-	scale    float32
+	scale    mgl32.Vec3
 	model    *Model
+	part     *ModelPart
+	parent   *Entity
 }
 
-// Load loads the uniform variables unique to the current entity. THE SHADER PROGRAM MUST BE ACTIVE!
-func (e *Entity) Load(shader *ShaderProgram) {
+// ModelMatrix returns the matrix that transforms the model of the entity into world space
+func (e *Entity) ModelMatrix() mgl32.Mat4 {
 	translation := mgl32.Translate3D(e.position.X(), e.position.Y(), e.position.Z())
 	rotationX := mgl32.HomogRotate3DX(e.rotation.X())
 	rotationY := mgl32.HomogRotate3DY(e.rotation.Y())
-	rotationZ := mgl32.HomogRotate3DY(e.rotation.Z())
-	scale := mgl32.Scale3D(e.scale, e.scale, e.scale)
+	rotationZ := mgl32.HomogRotate3DZ(e.rotation.Z())
+	scale := mgl32.Scale3D(e.scale.X(), e.scale.Y(), e.scale.Z())
 	modelMatrix := translation.Mul4(rotationX).Mul4(rotationY).Mul4(rotationZ).Mul4(scale)
-	shader.LoadUniformMatrix("modelMatrix", modelMatrix)
+	if e.parent != nil {
+		return e.parent.ModelMatrix().Mul4(modelMatrix)
+	}
+	return modelMatrix
+}
+
+// Load loads the uniform variables unique to the current entity. THE SHADER PROGRAM MUST BE ACTIVE!
+func (e *Entity) Load(shader *ShaderProgram) {
+	shader.LoadUniformMatrix("modelMatrix", e.ModelMatrix())
+}
+
+// Draw loads the entity uniforms and draws its model. If a part is attached to the entity, only that part is drawn.
+// Entities without a model only serve as parents and draw nothing. THE SHADER PROGRAM MUST BE ACTIVE AND THE MODEL BOUND!
+func (e *Entity) Draw(shader *ShaderProgram) {
+	if e.model == nil {
+		return
+	}
+	e.Load(shader)
+	if e.part != nil {
+		e.model.DrawPart(shader, e.part)
+	} else {
+		e.model.Draw(shader)
+	}
+}
+
+// SetRotationQuat sets the rotation of the entity from a quaternion
+func (e *Entity) SetRotationQuat(q mgl32.Quat) {
+	e.rotation = quatToEulerXYZ(q)
+}
+
+// quatToEulerXYZ converts a quaternion into the angles around x, y and z used by Entity, which are applied in that order
+func quatToEulerXYZ(q mgl32.Quat) mgl32.Vec3 {
+	// The rotation matrix is Rx * Ry * Rz, so m02 = sin(y), m12 = -sin(x)cos(y), m22 = cos(x)cos(y), m01 = -cos(y)sin(z) and m00 = cos(y)cos(z)
+	m := q.Normalize().Mat4()
+	sinY := float64(mgl32.Clamp(m.At(0, 2), -1, 1))
+	y := math.Asin(sinY)
+	if math.Abs(sinY) > 0.9999 {
+		// Gimbal lock, the z rotation is folded into the x rotation
+		return mgl32.Vec3{float32(math.Atan2(float64(m.At(2, 1)), float64(m.At(1, 1)))), float32(y), 0}
+	}
+	x := math.Atan2(float64(-m.At(1, 2)), float64(m.At(2, 2)))
+	z := math.Atan2(float64(-m.At(0, 1)), float64(m.At(0, 0)))
+	return mgl32.Vec3{float32(x), float32(y), float32(z)}
 }
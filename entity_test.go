@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestEntityRotation(t *testing.T) {
+	tests := []struct {
+		rotation      mgl32.Vec3
+		point, result mgl32.Vec3
+	}{
+		{mgl32.Vec3{math.Pi / 2, 0, 0}, mgl32.Vec3{0, 1, 0}, mgl32.Vec3{0, 0, 1}},
+		{mgl32.Vec3{0, math.Pi / 2, 0}, mgl32.Vec3{0, 0, 1}, mgl32.Vec3{1, 0, 0}},
+		// The z rotation used to rotate around the y axis
+		{mgl32.Vec3{0, 0, math.Pi / 2}, mgl32.Vec3{1, 0, 0}, mgl32.Vec3{0, 1, 0}},
+		// The z rotation is applied first, then y and x
+		{mgl32.Vec3{math.Pi / 2, 0, math.Pi / 2}, mgl32.Vec3{1, 0, 0}, mgl32.Vec3{0, 0, 1}},
+	}
+	for _, test := range tests {
+		e := Entity{position: mgl32.Vec3{1, 2, 3}, rotation: test.rotation, scale: mgl32.Vec3{2, 2, 2}}
+		result := mgl32.TransformCoordinate(test.point, e.ModelMatrix())
+		if expected := test.result.Mul(2).Add(e.position); !result.ApproxEqualThreshold(expected, 1e-5) {
+			t.Errorf("Rotation %v moves %v to %v instead of %v", test.rotation, test.point, result, expected)
+		}
+	}
+}
+
+func TestEntityParent(t *testing.T) {
+	parent := Entity{position: mgl32.Vec3{10, 0, 0}, rotation: mgl32.Vec3{0, 0, math.Pi / 2}, scale: mgl32.Vec3{1, 1, 1}}
+	child := Entity{position: mgl32.Vec3{1, 0, 0}, scale: mgl32.Vec3{2, 3, 4}, parent: &parent}
+	// The child is scaled per axis, moved along the x axis of the parent, which points along y, and then moved with the parent
+	result := mgl32.TransformCoordinate(mgl32.Vec3{1, 1, 1}, child.ModelMatrix())
+	if expected := (mgl32.Vec3{7, 3, 4}); !result.ApproxEqualThreshold(expected, 1e-5) {
+		t.Fatalf("Child moves the point to %v instead of %v", result, expected)
+	}
+}
+
+func TestSetRotationQuat(t *testing.T) {
+	rotations := []mgl32.Quat{
+		mgl32.QuatIdent(),
+		mgl32.QuatRotate(0.7, mgl32.Vec3{1, 2, 3}.Normalize()),
+		mgl32.QuatRotate(2.5, mgl32.Vec3{-1, 0.2, 0.1}.Normalize()),
+		// A rotation of 90 degrees around y is a gimbal lock
+		mgl32.QuatRotate(math.Pi/2, mgl32.Vec3{0, 1, 0}),
+	}
+	for _, q := range rotations {
+		e := Entity{scale: mgl32.Vec3{1, 1, 1}}
+		e.SetRotationQuat(q)
+		// ApproxEqualThreshold is relative, so it fails for entries that are almost zero
+		if difference := e.ModelMatrix().Sub(q.Mat4()); difference.Mul4(difference.Transpose()).Trace() > 1e-8 {
+			t.Errorf("Rotation %v gives the angles %v with the matrix\n%v\ninstead of\n%v", q, e.rotation, e.ModelMatrix(), q.Mat4())
+		}
+	}
+}
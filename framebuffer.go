@@ -111,7 +111,7 @@ func (f *Framebuffer) Draw(program *ShaderProgram) {
 	for i, t := range f.textures {
 		t.Bind(i)
 	}
-	quadModel.Draw()
+	quadModel.Draw(program)
 	for i, t := range f.textures {
 		t.Unbind(i)
 	}
@@ -0,0 +1,859 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// The header and chunk types of binary .glb files
+const (
+	glbMagic     = 0x46546C67
+	glbVersion   = 2
+	glbChunkJSON = 0x4E4F534A
+	glbChunkBIN  = 0x004E4942
+)
+
+// The component types of glTF accessors
+const (
+	gltfByte          = 5120
+	gltfUnsignedByte  = 5121
+	gltfShort         = 5122
+	gltfUnsignedShort = 5123
+	gltfUnsignedInt   = 5125
+	gltfFloat         = 5126
+)
+
+// The primitive modes of glTF meshes
+const (
+	gltfPoints        = 0
+	gltfLines         = 1
+	gltfLineLoop      = 2
+	gltfLineStrip     = 3
+	gltfTriangles     = 4
+	gltfTriangleStrip = 5
+	gltfTriangleFan   = 6
+)
+
+// gltfComponentSizes maps component types to their size in bytes
+var gltfComponentSizes = map[int]int{
+	gltfByte:          1,
+	gltfUnsignedByte:  1,
+	gltfShort:         2,
+	gltfUnsignedShort: 2,
+	gltfUnsignedInt:   4,
+	gltfFloat:         4,
+}
+
+// gltfTypeComponents maps accessor types to their number of components
+var gltfTypeComponents = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+	"MAT2":   4,
+	"MAT3":   9,
+	"MAT4":   16,
+}
+
+// GLTFAsset holds the meshes and nodes of a glTF file on the CPU side
+type GLTFAsset struct {
+	meshes []Mesh
+	nodes  []GLTFNode
+}
+
+// GLTFNode is a node of the default scene of a glTF file. Parents always come before their children
+type GLTFNode struct {
+	name        string
+	mesh        int
+	parent      int
+	translation mgl32.Vec3
+	rotation    mgl32.Quat
+	scale       mgl32.Vec3
+}
+
+// GLTFScene holds the uploaded models of a glTF file and an entity for every node
+type GLTFScene struct {
+	models   []Model
+	entities []Entity
+}
+
+// LoadGLTF loads a .gltf or .glb file, uploads its meshes and creates an entity for every node of the default scene
+func LoadGLTF(file string) (GLTFScene, error) {
+	asset, err := ParseGLTF(file)
+	if err != nil {
+		return GLTFScene{}, err
+	}
+
+	scene := GLTFScene{models: make([]Model, 0, len(asset.meshes)), entities: make([]Entity, len(asset.nodes))}
+	for i := range asset.meshes {
+		model, err := CreateModelFromMesh(&asset.meshes[i])
+		if err != nil {
+			scene.Delete()
+			return GLTFScene{}, err
+		}
+		scene.models = append(scene.models, model)
+	}
+	for i, node := range asset.nodes {
+		entity := &scene.entities[i]
+		entity.position = node.translation
+		entity.SetRotationQuat(node.rotation)
+		entity.scale = node.scale
+		if node.mesh >= 0 {
+			entity.model = &scene.models[node.mesh]
+		}
+		if node.parent >= 0 {
+			entity.parent = &scene.entities[node.parent]
+		}
+	}
+	return scene, nil
+}
+
+// Draw draws all entities of the scene. THE SHADER PROGRAM MUST BE ACTIVE!
+func (s *GLTFScene) Draw(shader *ShaderProgram) {
+	for i := range s.entities {
+		e := &s.entities[i]
+		if e.model == nil {
+			continue
+		}
+		e.model.Bind(shader)
+		e.Draw(shader)
+		e.model.Unbind(shader)
+	}
+}
+
+// Delete deletes all models of the scene
+func (s *GLTFScene) Delete() {
+	for i := range s.models {
+		s.models[i].Delete()
+	}
+}
+
+// gltfDocument is the JSON part of a glTF file. Only the properties used by the importer are decoded
+type gltfDocument struct {
+	Scene       *int              `json:"scene"`
+	Scenes      []gltfScene       `json:"scenes"`
+	Nodes       []gltfNode        `json:"nodes"`
+	Meshes      []gltfMesh        `json:"meshes"`
+	Accessors   []gltfAccessor    `json:"accessors"`
+	BufferViews []gltfBufferView  `json:"bufferViews"`
+	Buffers     []gltfBuffer      `json:"buffers"`
+	Materials   []gltfMaterial    `json:"materials"`
+	Textures    []gltfTexture     `json:"textures"`
+	Images      []gltfImage       `json:"images"`
+	Asset       map[string]string `json:"asset"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfNode struct {
+	Name        string    `json:"name"`
+	Children    []int     `json:"children"`
+	Mesh        *int      `json:"mesh"`
+	Matrix      []float32 `json:"matrix"`
+	Translation []float32 `json:"translation"`
+	Rotation    []float32 `json:"rotation"`
+	Scale       []float32 `json:"scale"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name"`
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices"`
+	Material   *int           `json:"material"`
+	Mode       *int           `json:"mode"`
+}
+
+type gltfAccessor struct {
+	BufferView    *int        `json:"bufferView"`
+	ByteOffset    int         `json:"byteOffset"`
+	ComponentType int         `json:"componentType"`
+	Normalized    bool        `json:"normalized"`
+	Count         int         `json:"count"`
+	Type          string      `json:"type"`
+	Sparse        *gltfSparse `json:"sparse"`
+}
+
+type gltfSparse struct {
+	Count   int `json:"count"`
+	Indices struct {
+		BufferView    int `json:"bufferView"`
+		ByteOffset    int `json:"byteOffset"`
+		ComponentType int `json:"componentType"`
+	} `json:"indices"`
+	Values struct {
+		BufferView int `json:"bufferView"`
+		ByteOffset int `json:"byteOffset"`
+	} `json:"values"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type gltfBuffer struct {
+	URI        string `json:"uri"`
+	ByteLength int    `json:"byteLength"`
+}
+
+type gltfMaterial struct {
+	Name                 string `json:"name"`
+	PbrMetallicRoughness struct {
+		BaseColorFactor  []float32       `json:"baseColorFactor"`
+		BaseColorTexture *gltfTextureRef `json:"baseColorTexture"`
+	} `json:"pbrMetallicRoughness"`
+	NormalTexture *gltfTextureRef `json:"normalTexture"`
+}
+
+type gltfTextureRef struct {
+	Index int `json:"index"`
+}
+
+type gltfTexture struct {
+	Source *int `json:"source"`
+}
+
+type gltfImage struct {
+	URI        string `json:"uri"`
+	BufferView *int   `json:"bufferView"`
+}
+
+// gltfLoader holds the state of a glTF file while its meshes are read
+type gltfLoader struct {
+	file      string
+	doc       gltfDocument
+	glbBuffer []byte
+	buffers   map[int][]byte
+	materials map[int]*Material
+}
+
+// ParseGLTF reads the meshes and the nodes of the default scene of a .gltf or .glb file without uploading them
+func ParseGLTF(file string) (GLTFAsset, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return GLTFAsset{}, err
+	}
+	l := gltfLoader{file: file, buffers: map[int][]byte{}, materials: map[int]*Material{}}
+
+	jsonData := data
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == glbMagic {
+		if jsonData, l.glbBuffer, err = parseGLB(data); err != nil {
+			return GLTFAsset{}, fmt.Errorf("Invalid glTF file %s: %v", file, err)
+		}
+	}
+	if err := json.Unmarshal(jsonData, &l.doc); err != nil {
+		return GLTFAsset{}, fmt.Errorf("Invalid glTF file %s: %v", file, err)
+	}
+	if version := l.doc.Asset["version"]; !strings.HasPrefix(version, "2.") {
+		return GLTFAsset{}, fmt.Errorf("Invalid glTF file %s: Unsupported version %q", file, version)
+	}
+
+	asset := GLTFAsset{meshes: make([]Mesh, len(l.doc.Meshes))}
+	for i := range l.doc.Meshes {
+		if asset.meshes[i], err = l.readMesh(i); err != nil {
+			return GLTFAsset{}, fmt.Errorf("Invalid mesh %d in %s: %v", i, file, err)
+		}
+	}
+	if asset.nodes, err = l.readNodes(); err != nil {
+		return GLTFAsset{}, fmt.Errorf("Invalid node in %s: %v", file, err)
+	}
+	return asset, nil
+}
+
+// parseGLB splits a binary .glb file into its JSON and binary chunk
+func parseGLB(data []byte) ([]byte, []byte, error) {
+	if len(data) < 12 || binary.LittleEndian.Uint32(data[4:]) != glbVersion {
+		return nil, nil, fmt.Errorf("Unsupported .glb header")
+	}
+	length := int(binary.LittleEndian.Uint32(data[8:]))
+	if length > len(data) {
+		return nil, nil, fmt.Errorf("File is truncated")
+	}
+	var jsonChunk, binChunk []byte
+	for offset := 12; offset+8 <= length; {
+		chunkLength := int(binary.LittleEndian.Uint32(data[offset:]))
+		chunkType := binary.LittleEndian.Uint32(data[offset+4:])
+		offset += 8
+		if chunkLength < 0 || offset+chunkLength > length {
+			return nil, nil, fmt.Errorf("Chunk exceeds the file")
+		}
+		switch chunkType {
+		case glbChunkJSON:
+			jsonChunk = data[offset : offset+chunkLength]
+		case glbChunkBIN:
+			binChunk = data[offset : offset+chunkLength]
+		}
+		offset += chunkLength
+	}
+	if jsonChunk == nil {
+		return nil, nil, fmt.Errorf("Missing JSON chunk")
+	}
+	return jsonChunk, binChunk, nil
+}
+
+// buffer returns the content of a buffer, which is either the binary chunk of a .glb file, a data URI or an external file
+func (l *gltfLoader) buffer(index int) ([]byte, error) {
+	if data, ok := l.buffers[index]; ok {
+		return data, nil
+	}
+	if index < 0 || index >= len(l.doc.Buffers) {
+		return nil, fmt.Errorf("Buffer %d does not exist", index)
+	}
+	buffer := l.doc.Buffers[index]
+	var data []byte
+	var err error
+	if buffer.URI == "" {
+		if index != 0 || l.glbBuffer == nil {
+			return nil, fmt.Errorf("Buffer %d has no URI", index)
+		}
+		data = l.glbBuffer
+	} else if data, err = l.readURI(buffer.URI); err != nil {
+		return nil, err
+	}
+	if len(data) < buffer.ByteLength {
+		return nil, fmt.Errorf("Buffer %d is shorter than its byteLength", index)
+	}
+	l.buffers[index] = data
+	return data, nil
+}
+
+// readURI reads the data of a base64 data URI or of a file relative to the glTF file
+func (l *gltfLoader) readURI(uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		i := strings.Index(uri, ";base64,")
+		if i < 0 {
+			return nil, fmt.Errorf("Unsupported data URI")
+		}
+		return base64.StdEncoding.DecodeString(uri[i+len(";base64,"):])
+	}
+	path, err := url.PathUnescape(uri)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filepath.Join(filepath.Dir(l.file), path))
+}
+
+// bufferView returns the bytes of a buffer view and its stride
+func (l *gltfLoader) bufferView(index int) ([]byte, int, error) {
+	if index < 0 || index >= len(l.doc.BufferViews) {
+		return nil, 0, fmt.Errorf("Buffer view %d does not exist", index)
+	}
+	view := l.doc.BufferViews[index]
+	buffer, err := l.buffer(view.Buffer)
+	if err != nil {
+		return nil, 0, err
+	}
+	if view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteOffset+view.ByteLength > len(buffer) {
+		return nil, 0, fmt.Errorf("Buffer view %d exceeds its buffer", index)
+	}
+	return buffer[view.ByteOffset : view.ByteOffset+view.ByteLength], view.ByteStride, nil
+}
+
+// gltfElements is a validated range of elements in a buffer view
+type gltfElements struct {
+	data              []byte
+	stride, size      int
+	count, components int
+}
+
+// elements returns the range of count elements of a buffer view starting at offset. It checks that the range is inside
+// of the buffer view, so the elements can be read and allocated for safely
+func (l *gltfLoader) elements(view, offset, count, components, componentType int) (gltfElements, error) {
+	size, ok := gltfComponentSizes[componentType]
+	if !ok {
+		return gltfElements{}, fmt.Errorf("Unsupported component type %d", componentType)
+	}
+	data, stride, err := l.bufferView(view)
+	if err != nil {
+		return gltfElements{}, err
+	}
+	if stride == 0 {
+		stride = components * size
+	}
+	if offset < 0 || count < 0 || stride < components*size {
+		return gltfElements{}, fmt.Errorf("Invalid offset, count or stride of an accessor of buffer view %d", view)
+	}
+	// The last element is checked without its stride, which avoids overflows for huge counts
+	if offset > len(data) || count > 0 && ((len(data)-offset-components*size)/stride < count-1 || len(data)-offset < components*size) {
+		return gltfElements{}, fmt.Errorf("Accessor exceeds buffer view %d", view)
+	}
+	return gltfElements{data[offset:], stride, size, count, components}, nil
+}
+
+// each calls fn with the bytes of every component of the elements
+func (e gltfElements) each(fn func(i int, b []byte)) {
+	for i := 0; i < e.count; i++ {
+		element := e.data[i*e.stride:]
+		for c := 0; c < e.components; c++ {
+			fn(i*e.components+c, element[c*e.size:])
+		}
+	}
+}
+
+// The maximum number of elements of an accessor without a buffer view, which has no data that limits its size
+const gltfMaxZeroElements = 1 << 24
+
+// readAccessor reads the components of an accessor as floats. Normalized integers are mapped to [0, 1] or [-1, 1]
+func (l *gltfLoader) readAccessor(index int) ([]float32, int, error) {
+	if index < 0 || index >= len(l.doc.Accessors) {
+		return nil, 0, fmt.Errorf("Accessor %d does not exist", index)
+	}
+	a := l.doc.Accessors[index]
+	components, ok := gltfTypeComponents[a.Type]
+	if !ok {
+		return nil, 0, fmt.Errorf("Unsupported accessor type %s", a.Type)
+	}
+	var values []float32
+	if a.BufferView != nil {
+		elements, err := l.elements(*a.BufferView, a.ByteOffset, a.Count, components, a.ComponentType)
+		if err != nil {
+			return nil, 0, err
+		}
+		values = make([]float32, a.Count*components)
+		elements.each(func(i int, b []byte) {
+			values[i] = gltfComponent(b, a.ComponentType, a.Normalized)
+		})
+	} else {
+		if a.Count < 0 || a.Count > gltfMaxZeroElements {
+			return nil, 0, fmt.Errorf("Invalid count %d of accessor %d", a.Count, index)
+		}
+		values = make([]float32, a.Count*components)
+	}
+
+	// Sparse accessors replace single elements of the buffer view, or of zeros if there is none
+	if a.Sparse != nil {
+		sparse := a.Sparse
+		sparseIndices, err := l.elements(sparse.Indices.BufferView, sparse.Indices.ByteOffset, sparse.Count, 1, sparse.Indices.ComponentType)
+		if err != nil {
+			return nil, 0, err
+		}
+		sparseElements, err := l.elements(sparse.Values.BufferView, sparse.Values.ByteOffset, sparse.Count, components, a.ComponentType)
+		if err != nil {
+			return nil, 0, err
+		}
+		indices := make([]uint32, sparse.Count)
+		sparseIndices.each(func(i int, b []byte) {
+			indices[i] = gltfIndex(b, sparse.Indices.ComponentType)
+		})
+		sparseValues := make([]float32, sparse.Count*components)
+		sparseElements.each(func(i int, b []byte) {
+			sparseValues[i] = gltfComponent(b, a.ComponentType, a.Normalized)
+		})
+		for i, index := range indices {
+			if int(index) >= a.Count {
+				return nil, 0, fmt.Errorf("Sparse index %d out of range", index)
+			}
+			copy(values[int(index)*components:(int(index)+1)*components], sparseValues[i*components:(i+1)*components])
+		}
+	}
+	return values, components, nil
+}
+
+// readIndices reads a scalar accessor of unsigned integers
+func (l *gltfLoader) readIndices(index int) ([]uint32, error) {
+	if index < 0 || index >= len(l.doc.Accessors) {
+		return nil, fmt.Errorf("Accessor %d does not exist", index)
+	}
+	a := l.doc.Accessors[index]
+	if a.Type != "SCALAR" || a.BufferView == nil || a.Sparse != nil {
+		return nil, fmt.Errorf("Unsupported index accessor %d", index)
+	}
+	if a.ComponentType != gltfUnsignedByte && a.ComponentType != gltfUnsignedShort && a.ComponentType != gltfUnsignedInt {
+		return nil, fmt.Errorf("Unsupported index component type %d", a.ComponentType)
+	}
+	elements, err := l.elements(*a.BufferView, a.ByteOffset, a.Count, 1, a.ComponentType)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]uint32, a.Count)
+	elements.each(func(i int, b []byte) {
+		indices[i] = gltfIndex(b, a.ComponentType)
+	})
+	return indices, nil
+}
+
+// gltfComponent converts a single component to a float
+func gltfComponent(b []byte, componentType int, normalized bool) float32 {
+	switch componentType {
+	case gltfByte:
+		if normalized {
+			return float32(math.Max(float64(int8(b[0]))/127, -1))
+		}
+		return float32(int8(b[0]))
+	case gltfUnsignedByte:
+		if normalized {
+			return float32(b[0]) / 255
+		}
+		return float32(b[0])
+	case gltfShort:
+		v := int16(binary.LittleEndian.Uint16(b))
+		if normalized {
+			return float32(math.Max(float64(v)/32767, -1))
+		}
+		return float32(v)
+	case gltfUnsignedShort:
+		v := binary.LittleEndian.Uint16(b)
+		if normalized {
+			return float32(v) / 65535
+		}
+		return float32(v)
+	case gltfUnsignedInt:
+		return float32(binary.LittleEndian.Uint32(b))
+	default:
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	}
+}
+
+// gltfIndex converts a single unsigned integer component to an index
+func gltfIndex(b []byte, componentType int) uint32 {
+	switch componentType {
+	case gltfUnsignedByte:
+		return uint32(b[0])
+	case gltfUnsignedShort:
+		return uint32(binary.LittleEndian.Uint16(b))
+	default:
+		return binary.LittleEndian.Uint32(b)
+	}
+}
+
+// readMesh reads all primitives of a mesh into a single mesh with one submesh per primitive. Points and lines become submeshes with their primitive mode
+func (l *gltfLoader) readMesh(index int) (Mesh, error) {
+	gltfMesh := l.doc.Meshes[index]
+	mesh := Mesh{}
+	part := ModelPart{name: gltfMesh.Name, object: gltfMesh.Name}
+	missingTangents := false
+
+	for i, primitive := range gltfMesh.Primitives {
+		position, ok := primitive.Attributes["POSITION"]
+		if !ok {
+			return Mesh{}, fmt.Errorf("Primitive %d has no positions", i)
+		}
+		positions, components, err := l.readAccessor(position)
+		if err != nil {
+			return Mesh{}, err
+		}
+		if components != 3 {
+			return Mesh{}, fmt.Errorf("Positions of primitive %d are not VEC3", i)
+		}
+		vertexCount := len(positions) / 3
+
+		var indices []uint32
+		if primitive.Indices != nil {
+			if indices, err = l.readIndices(*primitive.Indices); err != nil {
+				return Mesh{}, err
+			}
+		} else {
+			indices = make([]uint32, vertexCount)
+			for j := range indices {
+				indices[j] = uint32(j)
+			}
+		}
+		for _, index := range indices {
+			if int(index) >= vertexCount {
+				return Mesh{}, fmt.Errorf("Index %d of primitive %d out of range", index, i)
+			}
+		}
+		mode := gltfTriangles
+		if primitive.Mode != nil {
+			mode = *primitive.Mode
+		}
+		primitiveMode := PrimitiveTriangles
+		if indices, primitiveMode, err = gltfPrimitiveIndices(indices, mode); err != nil {
+			return Mesh{}, fmt.Errorf("Primitive %d: %v", i, err)
+		}
+		triangles := indices
+		if primitiveMode != PrimitiveTriangles {
+			triangles = nil
+		}
+
+		normals, err := l.readAttribute(primitive, "NORMAL", 3, vertexCount)
+		if err != nil {
+			return Mesh{}, err
+		}
+		if normals == nil {
+			normals = smoothNormals(positions, triangles)
+		}
+		tangents, err := l.readAttribute(primitive, "TANGENT", 4, vertexCount)
+		if err != nil {
+			return Mesh{}, err
+		}
+		textureCoords, err := l.readAttribute(primitive, "TEXCOORD_0", 2, vertexCount)
+		if err != nil {
+			return Mesh{}, err
+		}
+		if textureCoords == nil {
+			textureCoords = make([]float32, vertexCount*2)
+		}
+
+		// Points and lines are stored with the elements of the mesh
+		base := uint32(len(mesh.positions) / 3)
+		submesh := Submesh{offset: int32(len(mesh.indices)), count: int32(len(indices)), mode: primitiveMode}
+		if primitiveMode == PrimitiveTriangles {
+			for _, index := range indices {
+				mesh.indices = append(mesh.indices, base+index)
+			}
+		} else {
+			submesh.offset = int32(len(mesh.elementIndices))
+			for _, index := range indices {
+				mesh.elementIndices = append(mesh.elementIndices, base+index)
+			}
+		}
+		mesh.positions = append(mesh.positions, positions...)
+		mesh.normals = append(mesh.normals, normals...)
+		mesh.textureCoords = append(mesh.textureCoords, textureCoords...)
+		if tangents == nil {
+			missingTangents = true
+		}
+		mesh.tangents = append(mesh.tangents, tangents...)
+		if primitive.Material != nil {
+			if submesh.material, err = l.material(*primitive.Material); err != nil {
+				return Mesh{}, err
+			}
+		}
+		part.submeshes = append(part.submeshes, submesh)
+	}
+	mesh.parts = []ModelPart{part}
+	// Tangents are only used if every primitive has them, otherwise they are generated when needed
+	if missingTangents {
+		mesh.tangents = nil
+	}
+	return mesh, nil
+}
+
+// readAttribute reads an optional vertex attribute with the given number of components. It returns nil if the primitive does not have it
+func (l *gltfLoader) readAttribute(primitive gltfPrimitive, name string, components int, vertexCount int) ([]float32, error) {
+	index, ok := primitive.Attributes[name]
+	if !ok {
+		return nil, nil
+	}
+	values, actual, err := l.readAccessor(index)
+	if err != nil {
+		return nil, err
+	}
+	if actual != components || len(values) != vertexCount*components {
+		return nil, fmt.Errorf("Attribute %s does not match the positions", name)
+	}
+	return values, nil
+}
+
+// gltfPrimitiveIndices converts the indices of a primitive into a list of triangles, lines or points.
+// Strips, fans and loops are split into separate triangles and lines
+func gltfPrimitiveIndices(indices []uint32, mode int) ([]uint32, PrimitiveMode, error) {
+	switch mode {
+	case gltfPoints:
+		return indices, PrimitivePoints, nil
+	case gltfLines:
+		return indices[:len(indices)/2*2], PrimitiveLines, nil
+	case gltfLineLoop, gltfLineStrip:
+		lines := make([]uint32, 0, 2*len(indices))
+		for i := 1; i < len(indices); i++ {
+			lines = append(lines, indices[i-1], indices[i])
+		}
+		if mode == gltfLineLoop && len(indices) > 2 {
+			lines = append(lines, indices[len(indices)-1], indices[0])
+		}
+		return lines, PrimitiveLines, nil
+	case gltfTriangles:
+		return indices, PrimitiveTriangles, nil
+	case gltfTriangleStrip:
+		triangles := make([]uint32, 0, 3*len(indices))
+		for i := 2; i < len(indices); i++ {
+			// Every second triangle is flipped to keep the winding order
+			if i%2 == 0 {
+				triangles = append(triangles, indices[i-2], indices[i-1], indices[i])
+			} else {
+				triangles = append(triangles, indices[i-1], indices[i-2], indices[i])
+			}
+		}
+		return triangles, PrimitiveTriangles, nil
+	case gltfTriangleFan:
+		triangles := make([]uint32, 0, 3*len(indices))
+		for i := 2; i < len(indices); i++ {
+			triangles = append(triangles, indices[0], indices[i-1], indices[i])
+		}
+		return triangles, PrimitiveTriangles, nil
+	}
+	return nil, PrimitiveTriangles, fmt.Errorf("Unsupported primitive mode %d", mode)
+}
+
+// material returns the material with the given index. Materials are created once and shared between primitives
+func (l *gltfLoader) material(index int) (*Material, error) {
+	if m, ok := l.materials[index]; ok {
+		return m, nil
+	}
+	if index < 0 || index >= len(l.doc.Materials) {
+		return nil, fmt.Errorf("Material %d does not exist", index)
+	}
+	gltfMaterial := l.doc.Materials[index]
+	m := NewMaterial(gltfMaterial.Name)
+	if factor := gltfMaterial.PbrMetallicRoughness.BaseColorFactor; len(factor) == 4 {
+		m.diffuse = mgl32.Vec3{factor[0], factor[1], factor[2]}
+		m.dissolve = factor[3]
+	}
+	var err error
+	if ref := gltfMaterial.PbrMetallicRoughness.BaseColorTexture; ref != nil {
+		if m.diffuseMap, err = l.textureMap(m, ref.Index); err != nil {
+			return nil, err
+		}
+	}
+	if ref := gltfMaterial.NormalTexture; ref != nil {
+		if m.bumpMap, err = l.textureMap(m, ref.Index); err != nil {
+			return nil, err
+		}
+	}
+	l.materials[index] = m
+	return m, nil
+}
+
+// textureMap returns the map name of the image of a texture. Images that are embedded in the file are added to the material
+func (l *gltfLoader) textureMap(m *Material, texture int) (string, error) {
+	if texture < 0 || texture >= len(l.doc.Textures) || l.doc.Textures[texture].Source == nil {
+		return "", fmt.Errorf("Texture %d does not exist or has no image", texture)
+	}
+	source := *l.doc.Textures[texture].Source
+	if source < 0 || source >= len(l.doc.Images) {
+		return "", fmt.Errorf("Image %d does not exist", source)
+	}
+	image := l.doc.Images[source]
+	if image.URI != "" && !strings.HasPrefix(image.URI, "data:") {
+		path, err := url.PathUnescape(image.URI)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(filepath.Dir(l.file), path), nil
+	}
+
+	var data []byte
+	var err error
+	if image.URI != "" {
+		data, err = l.readURI(image.URI)
+	} else if image.BufferView != nil {
+		data, _, err = l.bufferView(*image.BufferView)
+	} else {
+		err = fmt.Errorf("Image %d has no data", source)
+	}
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s#image%d", l.file, source)
+	if m.mapData == nil {
+		m.mapData = map[string][]byte{}
+	}
+	m.mapData[name] = bytes.Clone(data)
+	return name, nil
+}
+
+// readNodes returns the nodes of the default scene with parents before their children.
+// Without scenes, all nodes that are not the child of another node are used as roots
+func (l *gltfLoader) readNodes() ([]GLTFNode, error) {
+	roots := []int{}
+	if len(l.doc.Scenes) > 0 {
+		scene := 0
+		if l.doc.Scene != nil {
+			scene = *l.doc.Scene
+		}
+		if scene < 0 || scene >= len(l.doc.Scenes) {
+			return nil, fmt.Errorf("Scene %d does not exist", scene)
+		}
+		roots = l.doc.Scenes[scene].Nodes
+	} else {
+		isChild := make([]bool, len(l.doc.Nodes))
+		for _, n := range l.doc.Nodes {
+			for _, c := range n.Children {
+				if c >= 0 && c < len(isChild) {
+					isChild[c] = true
+				}
+			}
+		}
+		for i := range l.doc.Nodes {
+			if !isChild[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+
+	nodes := []GLTFNode{}
+	visited := make([]bool, len(l.doc.Nodes))
+	var visit func(index, parent int) error
+	visit = func(index, parent int) error {
+		if index < 0 || index >= len(l.doc.Nodes) {
+			return fmt.Errorf("Node %d does not exist", index)
+		}
+		if visited[index] {
+			return fmt.Errorf("Node %d has more than one parent", index)
+		}
+		visited[index] = true
+		node, err := l.node(index)
+		if err != nil {
+			return err
+		}
+		node.parent = parent
+		nodes = append(nodes, node)
+		self := len(nodes) - 1
+		for _, child := range l.doc.Nodes[index].Children {
+			if err := visit(child, self); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, root := range roots {
+		if err := visit(root, -1); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// node converts a node into its name, mesh and local transform. Matrices are decomposed into translation, rotation and scale
+func (l *gltfLoader) node(index int) (GLTFNode, error) {
+	n := l.doc.Nodes[index]
+	node := GLTFNode{name: n.Name, mesh: -1, rotation: mgl32.QuatIdent(), scale: mgl32.Vec3{1, 1, 1}}
+	if n.Mesh != nil {
+		if *n.Mesh < 0 || *n.Mesh >= len(l.doc.Meshes) {
+			return node, fmt.Errorf("Mesh %d of node %d does not exist", *n.Mesh, index)
+		}
+		node.mesh = *n.Mesh
+	}
+
+	if len(n.Matrix) == 16 {
+		var m mgl32.Mat4
+		copy(m[:], n.Matrix)
+		node.translation = m.Col(3).Vec3()
+		node.scale = mgl32.Vec3{m.Col(0).Vec3().Len(), m.Col(1).Vec3().Len(), m.Col(2).Vec3().Len()}
+		if node.scale.X() != 0 && node.scale.Y() != 0 && node.scale.Z() != 0 {
+			rotation := mgl32.Mat4FromCols(m.Col(0).Mul(1/node.scale.X()), m.Col(1).Mul(1/node.scale.Y()), m.Col(2).Mul(1/node.scale.Z()), mgl32.Vec4{0, 0, 0, 1})
+			node.rotation = mgl32.Mat4ToQuat(rotation)
+		}
+		return node, nil
+	}
+	if len(n.Translation) == 3 {
+		node.translation = mgl32.Vec3{n.Translation[0], n.Translation[1], n.Translation[2]}
+	}
+	if len(n.Rotation) == 4 {
+		// glTF stores quaternions as x, y, z, w
+		node.rotation = mgl32.Quat{W: n.Rotation[3], V: mgl32.Vec3{n.Rotation[0], n.Rotation[1], n.Rotation[2]}}
+	}
+	if len(n.Scale) == 3 {
+		node.scale = mgl32.Vec3{n.Scale[0], n.Scale[1], n.Scale[2]}
+	}
+	return node, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// gltfTestBuffer returns the binary buffer of gltfTestDoc with the four positions of a quad and four 16 bit indices
+func gltfTestBuffer() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []float32{0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 1, 0})
+	binary.Write(&buf, binary.LittleEndian, []uint16{0, 1, 2, 3})
+	return buf.Bytes()
+}
+
+// gltfTestDoc returns a glTF document with a quad drawn as a triangle fan by the child of a translated root node.
+// The buffer is embedded in a .glb file if the uri is empty
+func gltfTestDoc(uri string, size int) map[string]interface{} {
+	buffer := map[string]interface{}{"byteLength": size}
+	if uri != "" {
+		buffer["uri"] = uri
+	}
+	return map[string]interface{}{
+		"asset":  map[string]string{"version": "2.0"},
+		"scene":  0,
+		"scenes": []interface{}{map[string]interface{}{"nodes": []int{0}}},
+		"nodes": []interface{}{
+			map[string]interface{}{"name": "root", "translation": []float32{1, 2, 3}, "children": []int{1}},
+			map[string]interface{}{"mesh": 0, "rotation": []float32{0, 0.7071068, 0, 0.7071068}},
+		},
+		"meshes": []interface{}{map[string]interface{}{"name": "quad", "primitives": []interface{}{
+			map[string]interface{}{"attributes": map[string]int{"POSITION": 0}, "indices": 1, "mode": 6, "material": 0},
+		}}},
+		"materials": []interface{}{map[string]interface{}{"name": "red", "pbrMetallicRoughness": map[string]interface{}{"baseColorFactor": []float32{1, 0, 0, 0.5}}}},
+		"accessors": []interface{}{
+			map[string]interface{}{"bufferView": 0, "componentType": 5126, "count": 4, "type": "VEC3"},
+			map[string]interface{}{"bufferView": 1, "componentType": 5123, "count": 4, "type": "SCALAR"},
+		},
+		"bufferViews": []interface{}{
+			map[string]interface{}{"buffer": 0, "byteLength": 48},
+			map[string]interface{}{"buffer": 0, "byteOffset": 48, "byteLength": 8},
+		},
+		"buffers": []interface{}{buffer},
+	}
+}
+
+// writeGLTF writes the document to a .gltf file in a temporary directory and returns its path
+func writeGLTF(t *testing.T, doc map[string]interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "test.gltf")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// writeGLB writes the document and the buffer to a .glb file in a temporary directory and returns its path
+func writeGLB(t *testing.T, doc map[string]interface{}, buffer []byte) string {
+	t.Helper()
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Chunks are padded to four bytes, the JSON chunk with spaces
+	for len(data)%4 != 0 {
+		data = append(data, ' ')
+	}
+	var glb bytes.Buffer
+	binary.Write(&glb, binary.LittleEndian, []uint32{0x46546C67, 2, uint32(12 + 8 + len(data) + 8 + len(buffer)), uint32(len(data)), 0x4E4F534A})
+	glb.Write(data)
+	binary.Write(&glb, binary.LittleEndian, []uint32{uint32(len(buffer)), 0x004E4942})
+	glb.Write(buffer)
+	file := filepath.Join(t.TempDir(), "test.glb")
+	if err := os.WriteFile(file, glb.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParseGLTF(t *testing.T) {
+	buffer := gltfTestBuffer()
+	files := map[string]string{
+		"gltf": writeGLTF(t, gltfTestDoc("data:application/octet-stream;base64,"+base64.StdEncoding.EncodeToString(buffer), len(buffer))),
+		"glb":  writeGLB(t, gltfTestDoc("", len(buffer)), buffer),
+	}
+	for name, file := range files {
+		t.Run(name, func(t *testing.T) {
+			asset, err := ParseGLTF(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(asset.meshes) != 1 || len(asset.nodes) != 2 {
+				t.Fatalf("%d meshes and %d nodes", len(asset.meshes), len(asset.nodes))
+			}
+			// The triangle fan is converted into a list
+			mesh := asset.meshes[0]
+			if len(mesh.indices) != 6 || mesh.indices[3] != 0 || mesh.indices[4] != 2 || mesh.indices[5] != 3 {
+				t.Fatalf("Indices %v", mesh.indices)
+			}
+			// Missing normals are generated and missing texture coordinates are zero
+			if mesh.normals[2] != 1 || len(mesh.textureCoords) != 8 {
+				t.Fatalf("Normals %v, texture coordinates %v", mesh.normals, mesh.textureCoords)
+			}
+			material := mesh.parts[0].submeshes[0].material
+			if material.name != "red" || material.diffuse[0] != 1 || material.dissolve != 0.5 {
+				t.Fatalf("Material %+v", material)
+			}
+			root, child := asset.nodes[0], asset.nodes[1]
+			if root.mesh != -1 || root.translation[1] != 2 || child.parent != 0 || child.mesh != 0 {
+				t.Fatalf("Nodes %+v", asset.nodes)
+			}
+		})
+	}
+}
+
+func TestGLTFInvalidAccessors(t *testing.T) {
+	data := gltfTestBuffer()
+	uri := "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(data)
+	tests := []struct {
+		name   string
+		modify func(doc map[string]interface{})
+	}{
+		{"negative count", func(doc map[string]interface{}) {
+			doc["accessors"].([]interface{})[0].(map[string]interface{})["count"] = -1
+		}},
+		{"huge count", func(doc map[string]interface{}) {
+			doc["accessors"].([]interface{})[0].(map[string]interface{})["count"] = math.MaxInt32
+		}},
+		{"negative byte offset", func(doc map[string]interface{}) {
+			doc["accessors"].([]interface{})[1].(map[string]interface{})["byteOffset"] = -4
+		}},
+		{"negative byte stride", func(doc map[string]interface{}) {
+			doc["bufferViews"].([]interface{})[0].(map[string]interface{})["byteStride"] = -12
+		}},
+		{"negative count without buffer view", func(doc map[string]interface{}) {
+			delete(doc["accessors"].([]interface{})[0].(map[string]interface{}), "bufferView")
+			doc["accessors"].([]interface{})[0].(map[string]interface{})["count"] = -1
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := gltfTestDoc(uri, len(data))
+			test.modify(doc)
+			if _, err := ParseGLTF(writeGLTF(t, doc)); err == nil {
+				t.Fatal("Expected an error")
+			}
+		})
+	}
+}
+
+func TestGLTFPointsAndLines(t *testing.T) {
+	data := gltfTestBuffer()
+	uri := "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(data)
+	tests := []struct {
+		mode     int
+		expected PrimitiveMode
+		indices  []uint32
+	}{
+		{gltfPoints, PrimitivePoints, []uint32{0, 1, 2, 3}},
+		{gltfLines, PrimitiveLines, []uint32{0, 1, 2, 3}},
+		{gltfLineLoop, PrimitiveLines, []uint32{0, 1, 1, 2, 2, 3, 3, 0}},
+		{gltfLineStrip, PrimitiveLines, []uint32{0, 1, 1, 2, 2, 3}},
+	}
+	for _, test := range tests {
+		doc := gltfTestDoc(uri, len(data))
+		primitive := doc["meshes"].([]interface{})[0].(map[string]interface{})["primitives"].([]interface{})[0].(map[string]interface{})
+		primitive["mode"] = test.mode
+		a, err := ParseGLTF(writeGLTF(t, doc))
+		if err != nil {
+			t.Fatalf("Mode %d: %v", test.mode, err)
+		}
+		m := a.meshes[0]
+		submesh := m.parts[0].submeshes[0]
+		if len(m.indices) != 0 || submesh.mode != test.expected || !reflect.DeepEqual(m.elementIndices, test.indices) {
+			t.Errorf("Mode %d: indices %v, elements %v, submesh %+v", test.mode, m.indices, m.elementIndices, submesh)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// The attribute locations of the instance data. A matrix takes the four locations from instanceMatrixAttribute on, one per column
+const (
+	instanceMatrixAttribute = 5
+	instanceColorAttribute  = 9
+)
+
+// InstanceBuffer holds the model matrices and optional RGBA colors of the instances of a model, which are all drawn with one draw call
+type InstanceBuffer struct {
+	matrices uint32
+	colors   uint32
+	count    int32
+	// Whether the last instances set had colors
+	hasColors bool
+}
+
+// NewInstanceBuffer creates an empty instance buffer
+func NewInstanceBuffer() InstanceBuffer {
+	buffer := InstanceBuffer{}
+	gl.GenBuffers(1, &buffer.matrices)
+	gl.GenBuffers(1, &buffer.colors)
+	return buffer
+}
+
+// Delete deletes the buffers of the instances
+func (b *InstanceBuffer) Delete() {
+	gl.DeleteBuffers(1, &b.matrices)
+	gl.DeleteBuffers(1, &b.colors)
+}
+
+// Count returns the number of instances
+func (b *InstanceBuffer) Count() int {
+	return int(b.count)
+}
+
+// SetInstances replaces the instances with the model matrices and colors. colors can be nil to draw all instances
+// in white, otherwise it needs a color for every matrix
+func (b *InstanceBuffer) SetInstances(matrices []mgl32.Mat4, colors []mgl32.Vec4) error {
+	if colors != nil && len(colors) != len(matrices) {
+		return errors.New("Instance colors don't match the number of matrices")
+	}
+	// The data is replaced as a whole, so the old storage is orphaned instead of waiting for draws that still use it.
+	// Clearing all instances is valid, but gl.Ptr needs at least one element
+	gl.BindBuffer(gl.ARRAY_BUFFER, b.matrices)
+	if len(matrices) > 0 {
+		gl.BufferData(gl.ARRAY_BUFFER, len(matrices)*16*4, gl.Ptr(matrices), gl.DYNAMIC_DRAW)
+	} else {
+		gl.BufferData(gl.ARRAY_BUFFER, 0, nil, gl.DYNAMIC_DRAW)
+	}
+	b.hasColors = len(colors) > 0
+	if b.hasColors {
+		gl.BindBuffer(gl.ARRAY_BUFFER, b.colors)
+		gl.BufferData(gl.ARRAY_BUFFER, len(colors)*4*4, gl.Ptr(colors), gl.DYNAMIC_DRAW)
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	b.count = int32(len(matrices))
+	return nil
+}
+
+// SetEntities replaces the instances with the world transforms of the entities
+func (b *InstanceBuffer) SetEntities(entities []*Entity, colors []mgl32.Vec4) error {
+	matrices := make([]mgl32.Mat4, len(entities))
+	for i, e := range entities {
+		matrices[i] = e.ModelMatrix()
+	}
+	return b.SetInstances(matrices, colors)
+}
+
+// bind sets up the instance attributes in the bound VAO, which advance once per instance
+func (b *InstanceBuffer) bind(shader *ShaderProgram) {
+	gl.BindBuffer(gl.ARRAY_BUFFER, b.matrices)
+	for column := uint32(0); column < 4; column++ {
+		location := instanceMatrixAttribute + column
+		gl.VertexAttribPointer(location, 4, gl.FLOAT, false, 16*4, gl.PtrOffset(int(column)*4*4))
+		gl.VertexAttribDivisor(location, 1)
+		gl.EnableVertexAttribArray(location)
+	}
+	if b.hasColors {
+		gl.BindBuffer(gl.ARRAY_BUFFER, b.colors)
+		gl.VertexAttribPointer(instanceColorAttribute, 4, gl.FLOAT, false, 0, nil)
+		gl.VertexAttribDivisor(instanceColorAttribute, 1)
+		gl.EnableVertexAttribArray(instanceColorAttribute)
+	} else {
+		gl.VertexAttrib4f(instanceColorAttribute, 1.0, 1.0, 1.0, 1.0)
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	shader.LoadUniformFloat("instanced", 1.0)
+}
+
+// unbind disables the instance attributes in the bound VAO, so the model draws without instances again
+func (b *InstanceBuffer) unbind(shader *ShaderProgram) {
+	for location := uint32(instanceMatrixAttribute); location <= instanceColorAttribute; location++ {
+		gl.VertexAttribDivisor(location, 0)
+		gl.DisableVertexAttribArray(location)
+	}
+	gl.VertexAttrib4f(instanceColorAttribute, 1.0, 1.0, 1.0, 1.0)
+	shader.LoadUniformFloat("instanced", 0.0)
+}
+
+// DrawInstanced draws all parts of the model that are not hidden once for every instance, using the matrices of the instances
+// instead of the modelMatrix uniform. Every submesh is a single draw call. The model and the shader should be already bound.
+func (m *Model) DrawInstanced(shader *ShaderProgram, instances *InstanceBuffer) {
+	m.DrawInstancedLOD(shader, instances, 0)
+}
+
+// DrawInstancedLOD draws the instances like DrawInstanced with the given level of detail
+func (m *Model) DrawInstancedLOD(shader *ShaderProgram, instances *InstanceBuffer, level int) {
+	if instances.count == 0 {
+		return
+	}
+	instances.bind(shader)
+	m.drawLevel(shader, level, instances.count)
+	instances.unbind(shader)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// LODOptions configures the chain of levels of detail generated for a mesh
+type LODOptions struct {
+	// Levels is the number of levels in addition to the full mesh
+	Levels int
+	// Ratio is the fraction of the triangles every level keeps of the previous level
+	Ratio float32
+	// MaxError limits the error of every level relative to the size of the mesh. 0 means no limit
+	MaxError float32
+}
+
+// meshLOD is a simplified level of detail of a mesh that uses the vertices of the full mesh
+type meshLOD struct {
+	indices []uint32
+	parts   []ModelPart
+	// The error of the level in model units
+	error float32
+}
+
+// modelLOD is a level of detail of a model. Its indices follow the indices of the full model in the index buffer
+type modelLOD struct {
+	offset int32
+	count  int32
+	// The submeshes of every part of the model
+	submeshes [][]Submesh
+	error     float32
+}
+
+// The largest error of a level of detail in pixels on screen when levels are selected by their error
+const lodMaxPixelError = 1.0
+
+// GenerateLODs simplifies the mesh into a chain of levels of detail, which are uploaded together with the mesh by CreateModelFromMesh.
+// Every level is simplified from the full mesh, so errors don't add up. The chain ends early if a level can't be simplified any further
+func (m *Mesh) GenerateLODs(options LODOptions) {
+	m.lods = nil
+	size := computeAABB(m.positions).Size().Len()
+	ratio := float32(1)
+	triangles := len(m.indices) / 3
+	for level := 0; level < options.Levels; level++ {
+		ratio *= options.Ratio
+		lod, relativeError := m.Simplify(SimplifyOptions{TargetRatio: ratio, MaxError: options.MaxError})
+		if len(lod.indices)/3 >= triangles || len(lod.indices) == 0 {
+			break
+		}
+		triangles = len(lod.indices) / 3
+		m.lods = append(m.lods, meshLOD{lod.indices, lod.parts, relativeError * size})
+	}
+}
+
+// modelIndices returns the indices of the mesh followed by its line and point elements and its levels of detail,
+// which is the layout of the index buffer of a model created from the mesh
+func modelIndices(mesh *Mesh) []uint32 {
+	indices := append(mesh.indices[:len(mesh.indices):len(mesh.indices)], mesh.elementIndices...)
+	for _, lod := range mesh.lods {
+		indices = append(indices, lod.indices...)
+	}
+	return indices
+}
+
+// setLODs takes the ranges of the levels of detail of the mesh in an index buffer laid out by modelIndices
+func (m *Model) setLODs(mesh *Mesh) {
+	elementOffset := int32(len(mesh.indices))
+	offset := elementOffset + int32(len(mesh.elementIndices))
+	m.lods = nil
+	for _, lod := range mesh.lods {
+		l := modelLOD{offset: offset, count: int32(len(lod.indices)), error: lod.error}
+		for _, p := range modelParts(lod.parts, l.offset, elementOffset) {
+			l.submeshes = append(l.submeshes, p.submeshes)
+		}
+		offset += l.count
+		m.lods = append(m.lods, l)
+	}
+}
+
+// LODCount returns the number of levels of detail of the model including the full model
+func (m *Model) LODCount() int {
+	return len(m.lods) + 1
+}
+
+// SetLODDistances sets the distances from the camera at which the levels of detail are used, starting with level 1.
+// Without distances, the coarsest level whose error is smaller than a pixel on screen is used
+func (m *Model) SetLODDistances(distances []float32) {
+	m.lodDistances = append([]float32{}, distances...)
+}
+
+// SelectLOD returns the level of detail for the model at the given distance from the camera, scaled by scale in world space
+func (m *Model) SelectLOD(distance, scale float32) int {
+	level := 0
+	if len(m.lodDistances) > 0 {
+		for i, d := range m.lodDistances {
+			if i < len(m.lods) && distance >= d {
+				level = i + 1
+			}
+		}
+		return level
+	}
+	// The size of one unit at a distance of one from the camera in pixels on screen
+	pixelsPerUnit := float32(windowHeight / (2 * math.Tan(float64(mgl32.DegToRad(fov))/2)))
+	for i, lod := range m.lods {
+		if lod.error*scale*pixelsPerUnit <= lodMaxPixelError*distance {
+			level = i + 1
+		}
+	}
+	return level
+}
+
+// DrawLOD draws all parts of the model that are not hidden with the given level of detail. Level 0 is the full model
+func (m *Model) DrawLOD(shader *ShaderProgram, level int) {
+	m.drawLevel(shader, level, 0)
+}
+
+// DrawPartLOD draws a single part of the model with the given level of detail, even if it is hidden
+func (m *Model) DrawPartLOD(shader *ShaderProgram, part *ModelPart, level int) {
+	if level > 0 && level <= len(m.lods) {
+		for i := range m.parts {
+			if &m.parts[i] == part {
+				m.drawSubmeshes(shader, m.lods[level-1].submeshes[i], 0)
+				return
+			}
+		}
+	}
+	m.DrawPart(shader, part)
+}
+
+// DrawLOD draws the entity like Draw with the level of detail of its model that fits the distance of its bounding sphere from the camera position
+func (e *Entity) DrawLOD(shader *ShaderProgram, cameraPosition mgl32.Vec3) {
+	if e.model == nil {
+		return
+	}
+	modelMatrix := e.ModelMatrix()
+	distance := e.model.sphere.Transform(modelMatrix).center.Sub(cameraPosition).Len()
+	level := e.model.SelectLOD(distance, matrixScale(modelMatrix))
+
+	shader.LoadUniformMatrix("modelMatrix", modelMatrix)
+	if e.part != nil {
+		e.model.DrawPartLOD(shader, e.part, level)
+	} else {
+		e.model.DrawLOD(shader, level)
+	}
+}
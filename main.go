@@ -52,7 +52,7 @@ func main() {
 	// }
 	defer model.Delete()
 
-	entity := Entity{mgl32.Vec3{0.0, -5.0, -20.0}, mgl32.Vec3{0.0, 0.0, 0.0}, 1.0, &model}
+	entity := Entity{position: mgl32.Vec3{0.0, -5.0, -20.0}, rotation: mgl32.Vec3{0.0, 0.0, 0.0}, scale: mgl32.Vec3{1.0, 1.0, 1.0}, model: &model}
 
 	// Load the shader
 	program, err := CreateProgramFromFiles("shaders/vertex.glsl", "shaders/fragment.glsl")
@@ -112,8 +112,7 @@ func main() {
 		program.LoadUniformVector("lightPos", mgl32.Vec3{0.0, 0.0, 0.0})
 		camera.Load(&program)
 		model.Bind(&program)
-		entity.Load(&program)
-		model.Draw()
+		entity.Draw(&program)
 		model.Unbind(&program)
 		program.Unuse()
 		fbo.Unuse()
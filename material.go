@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// The texture units the material textures are bound to
+const (
+	diffuseTextureUnit  = 0
+	bumpTextureUnit     = 1
+	specularTextureUnit = 2
+)
+
+// Material represents a material as described in a .mtl file
+type Material struct {
+	name      string
+	ambient   mgl32.Vec3
+	diffuse   mgl32.Vec3
+	specular  mgl32.Vec3
+	shininess float32
+	dissolve  float32
+	illum     int
+
+	diffuseMap  string
+	bumpMap     string
+	specularMap string
+
+	// The encoded images of texture maps that are embedded in the model file instead of being separate files, by map name
+	mapData map[string][]byte
+
+	diffuseTexture  Texture
+	bumpTexture     Texture
+	specularTexture Texture
+
+	// The number of submeshes of models and pooled meshes that use the material. The textures are deleted when the last one is deleted
+	users int
+}
+
+// NewMaterial creates a white, opaque material without any textures
+func NewMaterial(name string) *Material {
+	return &Material{
+		name:     name,
+		ambient:  mgl32.Vec3{1.0, 1.0, 1.0},
+		diffuse:  mgl32.Vec3{1.0, 1.0, 1.0},
+		specular: mgl32.Vec3{0.0, 0.0, 0.0},
+		dissolve: 1.0,
+	}
+}
+
+// LoadMaterialLibrary parses a .mtl file and returns its materials by name.
+// Texture paths are resolved relative to the directory of the .mtl file, but no textures are loaded
+func LoadMaterialLibrary(file string) (map[string]*Material, error) {
+	fileData, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(file)
+	materials := map[string]*Material{}
+	var current *Material
+
+	for i, l := range strings.Split(string(fileData), "\n") {
+		lineParts, columns := splitFields(l, nil, nil)
+		if len(lineParts) == 0 || strings.HasPrefix(lineParts[0], "#") {
+			continue
+		}
+		line := &ParseError{File: file, Line: i + 1, Token: strings.Join(lineParts, " ")}
+		if lineParts[0] == "newmtl" {
+			if len(lineParts) != 2 {
+				return nil, line.withReason("Expected a single material name", nil)
+			}
+			current = NewMaterial(lineParts[1])
+			materials[current.name] = current
+			continue
+		}
+		if current == nil {
+			return nil, line.withReason("No material declared with newmtl before", nil)
+		}
+
+		switch lineParts[0] {
+		case "Ka", "Kd", "Ks":
+			color, err := parseMaterialColor(lineParts[1:])
+			if err != nil {
+				return nil, line.withReason("Invalid color", err)
+			}
+			switch lineParts[0] {
+			case "Ka":
+				current.ambient = color
+			case "Kd":
+				current.diffuse = color
+			case "Ks":
+				current.specular = color
+			}
+		case "Ns", "d", "Tr":
+			if len(lineParts) != 2 {
+				return nil, line.withReason("Expected a single number", nil)
+			}
+			f, err := strconv.ParseFloat(lineParts[1], 32)
+			if err != nil {
+				return nil, line.withField(lineParts, columns, 1).withReason("Invalid number", err)
+			}
+			switch lineParts[0] {
+			case "Ns":
+				current.shininess = float32(f)
+			case "d":
+				current.dissolve = float32(f)
+			case "Tr":
+				current.dissolve = 1 - float32(f)
+			}
+		case "illum":
+			if len(lineParts) != 2 {
+				return nil, line.withReason("Expected a single number", nil)
+			}
+			illum, err := strconv.Atoi(lineParts[1])
+			if err != nil {
+				return nil, line.withField(lineParts, columns, 1).withReason("Invalid number", err)
+			}
+			current.illum = illum
+		case "map_Kd", "map_Bump", "map_bump", "bump", "map_Ks":
+			if len(lineParts) < 2 {
+				return nil, line.withReason("Missing texture path", nil)
+			}
+			// Texture options like -bm 1.0 precede the path, so the path is the last component
+			path := filepath.Join(dir, lineParts[len(lineParts)-1])
+			switch lineParts[0] {
+			case "map_Kd":
+				current.diffuseMap = path
+			case "map_Ks":
+				current.specularMap = path
+			default:
+				current.bumpMap = path
+			}
+		}
+	}
+	return materials, nil
+}
+
+// parseMaterialColor parses the r g b components of a color statement. If only r is given, it is used for all components
+func parseMaterialColor(components []string) (mgl32.Vec3, error) {
+	if len(components) != 1 && len(components) != 3 {
+		return mgl32.Vec3{}, fmt.Errorf("Expected one or three color components")
+	}
+	var color mgl32.Vec3
+	for i, n := range components {
+		f, err := strconv.ParseFloat(n, 32)
+		if err != nil {
+			return mgl32.Vec3{}, err
+		}
+		color[i] = float32(f)
+	}
+	if len(components) == 1 {
+		color[1], color[2] = color[0], color[0]
+	}
+	return color, nil
+}
+
+// LoadTextures loads all texture maps of the material. Mipmaps will be created if mipmap is true
+func (m *Material) LoadTextures(mipmap bool) error {
+	var err error
+	if m.diffuseMap != "" && m.diffuseTexture == 0 {
+		if m.diffuseTexture, err = m.loadMap(m.diffuseMap, mipmap); err != nil {
+			return err
+		}
+	}
+	if m.bumpMap != "" && m.bumpTexture == 0 {
+		if m.bumpTexture, err = m.loadMap(m.bumpMap, mipmap); err != nil {
+			return err
+		}
+	}
+	if m.specularMap != "" && m.specularTexture == 0 {
+		if m.specularTexture, err = m.loadMap(m.specularMap, mipmap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMap loads a texture map from the embedded images or from the file with the name of the map
+func (m *Material) loadMap(name string, mipmap bool) (Texture, error) {
+	if data, ok := m.mapData[name]; ok {
+		return NewTextureFromReader(bytes.NewReader(data), mipmap)
+	}
+	return NewTextureFromFile(name, mipmap)
+}
+
+// Delete deletes all textures of the material
+func (m *Material) Delete() {
+	for _, t := range []*Texture{&m.diffuseTexture, &m.bumpTexture, &m.specularTexture} {
+		if *t != 0 {
+			t.Delete()
+			*t = 0
+		}
+	}
+}
+
+// retainMaterials counts the submeshes of the parts as users of their materials
+func retainMaterials(parts []ModelPart) {
+	for _, p := range parts {
+		for _, s := range p.submeshes {
+			if s.material != nil {
+				s.material.users++
+			}
+		}
+	}
+}
+
+// releaseMaterials removes the submeshes of the parts from the users of their materials and deletes the textures of materials without users
+func releaseMaterials(parts []ModelPart) {
+	for _, p := range parts {
+		for _, s := range p.submeshes {
+			if s.material != nil && s.material.users > 0 {
+				s.material.users--
+				if s.material.users == 0 {
+					s.material.Delete()
+				}
+			}
+		}
+	}
+}
+
+// Bind binds the material textures and loads the material uniforms. THE SHADER PROGRAM MUST BE ACTIVE!
+func (m *Material) Bind(shader *ShaderProgram) {
+	shader.LoadUniformVector("diffuseColor", m.diffuse)
+	if m.diffuseTexture != 0 {
+		m.diffuseTexture.Bind(diffuseTextureUnit)
+		shader.LoadUniformFloat("hasTexture", 1.0)
+	} else {
+		shader.LoadUniformFloat("hasTexture", 0.0)
+	}
+	if m.bumpTexture != 0 {
+		m.bumpTexture.Bind(bumpTextureUnit)
+		shader.LoadUniformFloat("hasNormalMap", 1.0)
+	} else {
+		shader.LoadUniformFloat("hasNormalMap", 0.0)
+	}
+	if m.specularTexture != 0 {
+		m.specularTexture.Bind(specularTextureUnit)
+	}
+}
+
+// Unbind unbinds the material textures
+func (m *Material) Unbind(shader *ShaderProgram) {
+	if m.diffuseTexture != 0 {
+		m.diffuseTexture.Unbind(diffuseTextureUnit)
+	}
+	if m.bumpTexture != 0 {
+		m.bumpTexture.Unbind(bumpTextureUnit)
+	}
+	if m.specularTexture != 0 {
+		m.specularTexture.Unbind(specularTextureUnit)
+	}
+}
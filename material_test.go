@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// writeTestFiles writes the files into a temporary directory and returns the directory
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const testMTL = `newmtl red
+Kd 1 0 0
+d 0.5
+newmtl blue
+Kd 0 0 1
+`
+
+func TestLoadMaterialLibrary(t *testing.T) {
+	mtl := testMTL + `# A comment
+newmtl brick
+Ka 0.2
+Kd 0.8 0.3 0.1
+Ks 0.5 0.5 0.5
+Ns 32
+Tr 0.25
+illum 2
+map_Kd textures/brick.png
+map_Bump -bm 1.0 textures/brick_normal.png
+`
+	dir := writeTestFiles(t, map[string]string{"test.mtl": mtl})
+	materials, err := LoadMaterialLibrary(filepath.Join(dir, "test.mtl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(materials) != 3 || materials["red"].diffuse != (mgl32.Vec3{1, 0, 0}) || materials["red"].dissolve != 0.5 || materials["blue"].dissolve != 1 {
+		t.Fatalf("Materials %v", materials)
+	}
+	brick := materials["brick"]
+	if brick.name != "brick" || brick.ambient != (mgl32.Vec3{0.2, 0.2, 0.2}) || brick.diffuse != (mgl32.Vec3{0.8, 0.3, 0.1}) ||
+		brick.specular != (mgl32.Vec3{0.5, 0.5, 0.5}) || brick.shininess != 32 || brick.dissolve != 0.75 || brick.illum != 2 {
+		t.Fatalf("Material %+v", brick)
+	}
+	// Texture paths are relative to the library and options before the path are skipped
+	if brick.diffuseMap != filepath.Join(dir, "textures", "brick.png") || brick.bumpMap != filepath.Join(dir, "textures", "brick_normal.png") || brick.specularMap != "" {
+		t.Fatalf("Texture maps %q %q %q", brick.diffuseMap, brick.bumpMap, brick.specularMap)
+	}
+
+	for _, invalid := range []string{"Kd 1 0 0\n", "newmtl\n", "newmtl a\nKd 1 0\n", "newmtl a\nNs x\n", "newmtl a\nillum 1.5\n", "newmtl a\nmap_Kd\n"} {
+		dir := writeTestFiles(t, map[string]string{"invalid.mtl": invalid})
+		if _, err := LoadMaterialLibrary(filepath.Join(dir, "invalid.mtl")); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestLoadMaterialLibraryErrors(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"invalid.mtl": "newmtl a\n\nNs  x\n", "invalid.obj": "mtllib invalid.mtl\n"})
+	_, err := LoadMaterialLibrary(filepath.Join(dir, "invalid.mtl"))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 3 || parseErr.Column != 5 || parseErr.Token != "x" {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	// The error of the library is wrapped in the warning of the mtllib line, and the mesh is loaded without it
+	warnings := []*ParseError{}
+	_, err = LoadOBJ(filepath.Join(dir, "invalid.obj"), ObjOptions{Warnings: func(warning *ParseError) { warnings = append(warnings, warning) }})
+	if err != nil || len(warnings) != 1 || warnings[0].Line != 1 || warnings[0].Column != 8 {
+		t.Fatalf("Unexpected error %v with warnings %v", err, warnings)
+	}
+	if inner := errors.Unwrap(warnings[0]); !errors.As(inner, &parseErr) || parseErr.Line != 3 {
+		t.Fatalf("Unexpected library error %v", inner)
+	}
+}
+
+func TestMaterialUsers(t *testing.T) {
+	shared, own := NewMaterial("shared"), NewMaterial("own")
+	first := []ModelPart{{submeshes: []Submesh{{material: shared}, {material: own}, {}}}}
+	second := []ModelPart{{submeshes: []Submesh{{material: shared}}}}
+	retainMaterials(first)
+	retainMaterials(second)
+	if shared.users != 2 || own.users != 1 {
+		t.Fatalf("Expected 2 and 1 users, got %d and %d", shared.users, own.users)
+	}
+	// The textures of the shared material stay until its last user is deleted
+	releaseMaterials(first)
+	if shared.users != 1 || own.users != 0 {
+		t.Fatalf("Expected 1 and 0 users, got %d and %d", shared.users, own.users)
+	}
+	releaseMaterials(second)
+	releaseMaterials(second)
+	if shared.users != 0 {
+		t.Fatalf("Expected no users, got %d", shared.users)
+	}
+}
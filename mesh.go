@@ -0,0 +1,25 @@
+package main
+
+// Mesh represents geometry on the CPU side. It can be created and processed without an OpenGL context
+// and is turned into a Model by uploading it with CreateModelFromMesh
+type Mesh struct {
+	positions     []float32
+	textureCoords []float32
+	normals       []float32
+	indices       []uint32
+	parts         []ModelPart
+
+	// The indices of line and point elements, which are drawn by submeshes with their primitive mode.
+	// They are kept apart from the triangles, which is what all processing of the mesh works on
+	elementIndices []uint32
+
+	// The optional RGBA colors of the vertices
+	colors []float32
+	// The optional tangents of the vertices with the sign of the bitangent as fourth component
+	tangents []float32
+	// The simplified levels of detail generated by GenerateLODs
+	lods []meshLOD
+
+	// The paths of the material libraries the materials were loaded from
+	materialLibraries []string
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// The binary mesh format starts with meshFileMagic and meshFileVersion, followed by a header with the hash of the source file,
+// the vertex, index and element index count, the attribute layout, the materials, the parts and the material libraries of the source.
+// Then the attributes follow in the order of the layout, the indices and the element indices, all little-endian. The file ends with a CRC-32 checksum
+// of everything before it
+const (
+	meshFileMagic   = "MESH"
+	meshFileVersion = 2
+)
+
+// The ids of the vertex attributes in the attribute layout of a mesh file
+const (
+	meshAttributePosition = iota
+	meshAttributeTextureCoord
+	meshAttributeNormal
+	meshAttributeColor
+	meshAttributeTangent
+)
+
+// The component type of a vertex attribute in a mesh file
+const meshComponentFloat32 = 0
+
+// meshFileAttribute describes a vertex attribute of a mesh in the attribute layout of a mesh file
+type meshFileAttribute struct {
+	id         uint8
+	components uint8
+	data       *[]float32
+}
+
+// meshFileAttributes returns all vertex attributes a mesh file can contain
+func meshFileAttributes(mesh *Mesh) []meshFileAttribute {
+	return []meshFileAttribute{
+		{meshAttributePosition, 3, &mesh.positions},
+		{meshAttributeTextureCoord, 2, &mesh.textureCoords},
+		{meshAttributeNormal, 3, &mesh.normals},
+		{meshAttributeColor, 4, &mesh.colors},
+		{meshAttributeTangent, 4, &mesh.tangents},
+	}
+}
+
+// ErrInvalidMeshFile is returned when decoding data that is not a mesh file or a mesh file with an unsupported version
+var ErrInvalidMeshFile = errors.New("Invalid mesh file")
+
+// ErrMeshChecksum is returned when decoding a mesh file whose checksum does not match its content
+var ErrMeshChecksum = errors.New("Mesh file checksum mismatch")
+
+// meshFileLibrary is a material library of the source file and its hash, which allows detecting changes to it
+type meshFileLibrary struct {
+	path string
+	hash [sha256.Size]byte
+}
+
+// meshFileHeader holds the information about the source of a mesh file
+type meshFileHeader struct {
+	source    [sha256.Size]byte
+	libraries []meshFileLibrary
+}
+
+// EncodeMesh writes the mesh in the binary mesh format
+func EncodeMesh(w io.Writer, mesh *Mesh) error {
+	return encodeMesh(w, mesh, meshFileHeader{})
+}
+
+// DecodeMesh reads a mesh in the binary mesh format
+func DecodeMesh(r io.Reader) (Mesh, error) {
+	mesh, _, err := decodeMesh(r)
+	return mesh, err
+}
+
+func encodeMesh(w io.Writer, mesh *Mesh, header meshFileHeader) error {
+	buffered := bufio.NewWriter(w)
+	checksum := crc32.NewIEEE()
+	mw := meshWriter{w: io.MultiWriter(buffered, checksum)}
+
+	mw.bytes([]byte(meshFileMagic))
+	mw.uint32(meshFileVersion)
+	mw.bytes(header.source[:])
+	mw.uint32(uint32(len(mesh.positions) / 3))
+	mw.uint32(uint32(len(mesh.indices)))
+	mw.uint32(uint32(len(mesh.elementIndices)))
+
+	// Only attributes the mesh has are stored
+	layout := []meshFileAttribute{}
+	for _, attribute := range meshFileAttributes(mesh) {
+		if len(*attribute.data) > 0 {
+			layout = append(layout, attribute)
+		}
+	}
+	mw.uint32(uint32(len(layout)))
+	for _, attribute := range layout {
+		mw.bytes([]byte{attribute.id, attribute.components, meshComponentFloat32})
+	}
+
+	// Materials are shared between submeshes and stored once
+	materials := []*Material{}
+	materialIndices := map[*Material]int32{}
+	for _, p := range mesh.parts {
+		for _, s := range p.submeshes {
+			if _, ok := materialIndices[s.material]; s.material != nil && !ok {
+				materialIndices[s.material] = int32(len(materials))
+				materials = append(materials, s.material)
+			}
+		}
+	}
+	mw.uint32(uint32(len(materials)))
+	for _, m := range materials {
+		mw.string(m.name)
+		mw.float32s(m.ambient[:])
+		mw.float32s(m.diffuse[:])
+		mw.float32s(m.specular[:])
+		mw.float32s([]float32{m.shininess, m.dissolve})
+		mw.uint32(uint32(int32(m.illum)))
+		mw.string(m.diffuseMap)
+		mw.string(m.bumpMap)
+		mw.string(m.specularMap)
+	}
+
+	mw.uint32(uint32(len(mesh.parts)))
+	for _, p := range mesh.parts {
+		mw.string(p.name)
+		mw.string(p.object)
+		mw.uint32(uint32(len(p.submeshes)))
+		for _, s := range p.submeshes {
+			material := int32(-1)
+			if s.material != nil {
+				material = materialIndices[s.material]
+			}
+			mw.uint32(uint32(s.offset))
+			mw.uint32(uint32(s.count))
+			mw.uint32(uint32(s.mode))
+			mw.uint32(uint32(material))
+		}
+	}
+
+	mw.uint32(uint32(len(header.libraries)))
+	for _, l := range header.libraries {
+		mw.string(l.path)
+		mw.bytes(l.hash[:])
+	}
+
+	for _, attribute := range layout {
+		mw.float32s(*attribute.data)
+	}
+	mw.uint32s(mesh.indices)
+	mw.uint32s(mesh.elementIndices)
+
+	if mw.err != nil {
+		return mw.err
+	}
+	if err := binary.Write(buffered, binary.LittleEndian, checksum.Sum32()); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+func decodeMesh(r io.Reader) (Mesh, meshFileHeader, error) {
+	checksum := crc32.NewIEEE()
+	buffered := bufio.NewReader(r)
+	mr := meshReader{r: io.TeeReader(buffered, checksum)}
+	header := meshFileHeader{}
+
+	magic := make([]byte, len(meshFileMagic))
+	mr.bytes(magic)
+	if mr.err != nil || string(magic) != meshFileMagic || mr.uint32() != meshFileVersion {
+		return Mesh{}, header, ErrInvalidMeshFile
+	}
+	mr.bytes(header.source[:])
+	vertexCount := int(mr.uint32())
+	indexCount := int(mr.uint32())
+	elementIndexCount := int(mr.uint32())
+
+	mesh := Mesh{}
+	layout := make([]meshFileAttribute, mr.count())
+	for i := range layout {
+		var attribute [3]uint8
+		mr.bytes(attribute[:])
+		if mr.err != nil {
+			break
+		}
+		found := false
+		for _, a := range meshFileAttributes(&mesh) {
+			if a.id == attribute[0] && a.components == attribute[1] && attribute[2] == meshComponentFloat32 {
+				layout[i], found = a, true
+			}
+		}
+		if !found {
+			return Mesh{}, header, fmt.Errorf("%w: Unsupported attribute %v", ErrInvalidMeshFile, attribute)
+		}
+	}
+
+	materials := make([]*Material, mr.count())
+	for i := range materials {
+		m := NewMaterial(mr.string())
+		mr.float32s(m.ambient[:])
+		mr.float32s(m.diffuse[:])
+		mr.float32s(m.specular[:])
+		m.shininess = mr.float32()
+		m.dissolve = mr.float32()
+		m.illum = int(int32(mr.uint32()))
+		m.diffuseMap = mr.string()
+		m.bumpMap = mr.string()
+		m.specularMap = mr.string()
+		materials[i] = m
+	}
+
+	mesh.parts = make([]ModelPart, mr.count())
+	for i := range mesh.parts {
+		p := &mesh.parts[i]
+		p.name = mr.string()
+		p.object = mr.string()
+		p.submeshes = make([]Submesh, mr.count())
+		for j := range p.submeshes {
+			s := &p.submeshes[j]
+			s.offset = int32(mr.uint32())
+			s.count = int32(mr.uint32())
+			s.mode = PrimitiveMode(mr.uint32())
+			material := int32(mr.uint32())
+			if material >= int32(len(materials)) {
+				return Mesh{}, header, fmt.Errorf("%w: Material index out of range", ErrInvalidMeshFile)
+			}
+			if material >= 0 {
+				s.material = materials[material]
+			}
+		}
+	}
+
+	header.libraries = make([]meshFileLibrary, mr.count())
+	for i := range header.libraries {
+		header.libraries[i].path = mr.string()
+		mr.bytes(header.libraries[i].hash[:])
+	}
+
+	// The counts are not trusted, so the data grows with the input instead of being allocated up front
+	for _, attribute := range layout {
+		*attribute.data = mr.growFloat32s(vertexCount * int(attribute.components))
+	}
+	mesh.indices = mr.growUint32s(indexCount)
+	if elementIndexCount > 0 {
+		mesh.elementIndices = mr.growUint32s(elementIndexCount)
+	}
+	if mr.err != nil {
+		return Mesh{}, header, mr.err
+	}
+
+	expected := checksum.Sum32()
+	var actual uint32
+	if err := binary.Read(buffered, binary.LittleEndian, &actual); err != nil {
+		return Mesh{}, header, err
+	}
+	if actual != expected {
+		return Mesh{}, header, ErrMeshChecksum
+	}
+	return mesh, header, nil
+}
+
+// meshWriter writes little-endian values and remembers the first error, so it only has to be checked once
+type meshWriter struct {
+	w   io.Writer
+	err error
+	buf [4]byte
+}
+
+func (mw *meshWriter) bytes(b []byte) {
+	if mw.err == nil {
+		_, mw.err = mw.w.Write(b)
+	}
+}
+
+func (mw *meshWriter) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(mw.buf[:], v)
+	mw.bytes(mw.buf[:])
+}
+
+func (mw *meshWriter) string(s string) {
+	mw.uint32(uint32(len(s)))
+	mw.bytes([]byte(s))
+}
+
+func (mw *meshWriter) float32s(values []float32) {
+	for _, v := range values {
+		mw.uint32(math.Float32bits(v))
+	}
+}
+
+func (mw *meshWriter) uint32s(values []uint32) {
+	for _, v := range values {
+		mw.uint32(v)
+	}
+}
+
+// meshReader reads little-endian values and remembers the first error, so it only has to be checked once.
+// After an error all reads return zero values
+type meshReader struct {
+	r   io.Reader
+	err error
+	buf [4]byte
+}
+
+// The maximum length of strings and lists in the header. It protects against huge allocations when reading corrupt files
+const meshFileMaxCount = 1 << 20
+
+func (mr *meshReader) bytes(b []byte) {
+	if mr.err == nil {
+		_, mr.err = io.ReadFull(mr.r, b)
+	}
+	if mr.err != nil {
+		for i := range b {
+			b[i] = 0
+		}
+	}
+}
+
+func (mr *meshReader) uint32() uint32 {
+	mr.bytes(mr.buf[:])
+	return binary.LittleEndian.Uint32(mr.buf[:])
+}
+
+func (mr *meshReader) float32() float32 {
+	return math.Float32frombits(mr.uint32())
+}
+
+// count reads the length of a string or list
+func (mr *meshReader) count() int {
+	n := mr.uint32()
+	if n > meshFileMaxCount && mr.err == nil {
+		mr.err = fmt.Errorf("%w: Length %d too large", ErrInvalidMeshFile, n)
+	}
+	if mr.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (mr *meshReader) string() string {
+	b := make([]byte, mr.count())
+	mr.bytes(b)
+	return string(b)
+}
+
+func (mr *meshReader) float32s(values []float32) {
+	b := make([]byte, len(values)*4)
+	mr.bytes(b)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+}
+
+// The number of values that are read at once by growFloat32s and growUint32s
+const meshFileChunk = 64 * 1024
+
+// growFloat32s reads n floats in chunks, so a corrupt count fails at the end of the input instead of allocating all values first
+func (mr *meshReader) growFloat32s(n int) []float32 {
+	values := make([]float32, 0, minInt(n, meshFileChunk))
+	for len(values) < n && mr.err == nil {
+		chunk := minInt(n-len(values), meshFileChunk)
+		values = append(values, make([]float32, chunk)...)
+		mr.float32s(values[len(values)-chunk:])
+	}
+	return values
+}
+
+// growUint32s reads n unsigned ints in chunks like growFloat32s
+func (mr *meshReader) growUint32s(n int) []uint32 {
+	values := make([]uint32, 0, minInt(n, meshFileChunk))
+	for len(values) < n && mr.err == nil {
+		chunk := minInt(n-len(values), meshFileChunk)
+		values = append(values, make([]uint32, chunk)...)
+		mr.uint32s(values[len(values)-chunk:])
+	}
+	return values
+}
+
+func (mr *meshReader) uint32s(values []uint32) {
+	b := make([]byte, len(values)*4)
+	mr.bytes(b)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMeshFileRoundTrip(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"test.obj": testOBJ, "test.mtl": testMTL})
+	mesh, err := LoadOBJ(filepath.Join(dir, "test.obj"), ObjOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := EncodeMesh(&buf, &mesh); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeMesh(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mesh.materialLibraries = nil
+	if !reflect.DeepEqual(mesh, decoded) {
+		t.Fatalf("Decoded mesh differs:\n%+v\n%+v", mesh, decoded)
+	}
+
+	corrupt := append([]byte{}, buf.Bytes()...)
+	corrupt[len(corrupt)/2] ^= 1
+	if _, err := DecodeMesh(bytes.NewReader(corrupt)); err == nil {
+		t.Fatal("Expected an error for a corrupt file")
+	}
+	if _, err := DecodeMesh(bytes.NewReader(buf.Bytes()[:len(buf.Bytes())-10])); err == nil {
+		t.Fatal("Expected an error for a truncated file")
+	}
+}
+
+func TestMeshFileHugeCounts(t *testing.T) {
+	// The vertex, index and element index counts follow the magic, the version and the source hash
+	countsOffset := len(meshFileMagic) + 4 + 32
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		mesh := Mesh{positions: []float32{0, 0, 0, 1, 0, 0, 0, 1, 0}, indices: []uint32{0, 1, 2}}
+		if err := EncodeMesh(&buf, &mesh); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		binary.LittleEndian.PutUint32(data[countsOffset+4*i:], 0xffffffff)
+		_, err := DecodeMesh(bytes.NewReader(data))
+		if err == nil {
+			t.Fatalf("Count %d: expected an error", i)
+		}
+		if errors.Is(err, ErrMeshChecksum) {
+			t.Fatalf("Count %d: the data should end before the checksum", i)
+		}
+	}
+}
+
+func TestOBJCache(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"test.obj": testOBJ, "test.mtl": testMTL})
+	cacheDir := filepath.Join(dir, "cache")
+	file := filepath.Join(dir, "test.obj")
+	parsed, err := LoadOBJ(file, ObjOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := LoadOBJ(file, ObjOptions{CacheDir: cacheDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected a single cache file: %v %v", entries, err)
+	}
+	cached, err := LoadOBJ(file, ObjOptions{CacheDir: cacheDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, first) || !reflect.DeepEqual(parsed.positions, cached.positions) ||
+		!reflect.DeepEqual(parsed.indices, cached.indices) || !reflect.DeepEqual(parsed.materialLibraries, cached.materialLibraries) {
+		t.Fatal("Cached mesh differs")
+	}
+
+	// A changed material library invalidates the cache
+	if err := os.WriteFile(filepath.Join(dir, "test.mtl"), []byte(testMTL+"newmtl green\nKd 0 1 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cacheFile, err := objCachePath(file, cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := objCacheSource(file, ObjOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := readMeshCache(cacheFile, source); ok {
+		t.Fatal("Cache should be invalid after the material library changed")
+	}
+}
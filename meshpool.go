@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// MeshPool stores many meshes in one interleaved vertex buffer and one index buffer that share a VAO, so they can be drawn
+// without switching buffers. The buffers grow when a mesh does not fit and freed ranges are reused by later meshes.
+// The indices are always stored as unsigned ints, since all meshes share the index type
+type MeshPool struct {
+	vao      uint32
+	vertices uint32
+	indices  uint32
+	layout   VertexLayout
+
+	// The free ranges of the buffers in vertices and indices
+	freeVertices poolAllocator
+	freeIndices  poolAllocator
+	// Counts the removed meshes, so renderers notice when their queued draws refer to removed meshes
+	generation int
+}
+
+// PooledMesh is a mesh that was added to a pool. Its indices are relative to its first vertex, which is passed to
+// the draw calls as the base vertex
+type PooledMesh struct {
+	pool        *MeshPool
+	firstVertex int32
+	vertexCount int32
+	firstIndex  int32
+	indexCount  int32
+	// The submeshes index into the index buffer of the pool
+	parts  []ModelPart
+	bounds AABB
+	sphere BoundingSphere
+}
+
+// poolAllocator hands out ranges of a buffer with a first fit search over the sorted free ranges
+type poolAllocator struct {
+	free     []poolRange
+	capacity int
+}
+
+// poolRange is a range of vertices or indices of a pool
+type poolRange struct {
+	offset, count int
+}
+
+// The size of an index in the pool in bytes
+const poolIndexSize = 4
+
+// NewMeshPool creates a pool for meshes with the vertex layout and room for the given number of vertices and indices
+func NewMeshPool(layout VertexLayout, vertices, indices int) *MeshPool {
+	p := &MeshPool{layout: layout}
+	gl.GenVertexArrays(1, &p.vao)
+	gl.GenBuffers(1, &p.vertices)
+	gl.GenBuffers(1, &p.indices)
+	gl.BindVertexArray(p.vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, p.vertices)
+	gl.BufferData(gl.ARRAY_BUFFER, vertices*layout.stride, nil, gl.DYNAMIC_DRAW)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, p.indices)
+	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, indices*poolIndexSize, nil, gl.DYNAMIC_DRAW)
+	p.setAttributes()
+	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, 0)
+	p.freeVertices.grow(vertices)
+	p.freeIndices.grow(indices)
+	return p
+}
+
+// setAttributes points the attributes of the bound VAO to the vertex buffer
+func (p *MeshPool) setAttributes() {
+	gl.BindBuffer(gl.ARRAY_BUFFER, p.vertices)
+	for _, a := range p.layout.attributes {
+		gl.VertexAttribPointer(a.Location, a.Components, a.Type.glType(), a.Normalized, int32(p.layout.stride), gl.PtrOffset(a.Offset))
+	}
+}
+
+// Add uploads the vertices, triangles, lines and points of the mesh into the pool and loads the textures of its materials.
+// The mesh needs the data of every attribute of the layout. Levels of detail are not added. Lines and points are only
+// drawn by the submeshes of parts, so the element indices of a mesh without parts are not added. Pools can't hold
+// patches, since the batches of a renderer don't know their number of vertices. If a material has a bump map, the layout
+// of the pool needs a tangent attribute like the one of MeshVertexLayout
+func (p *MeshPool) Add(mesh *Mesh) (*PooledMesh, error) {
+	if err := p.layout.checkTangents(mesh); err != nil {
+		return nil, err
+	}
+	for _, part := range mesh.parts {
+		for _, s := range part.submeshes {
+			if s.mode == PrimitivePatches {
+				return nil, errors.New("Patches can't be added to a mesh pool")
+			}
+		}
+	}
+	if err := prepareMesh(mesh); err != nil {
+		return nil, err
+	}
+	elementIndices := mesh.elementIndices
+	if len(mesh.parts) == 0 {
+		elementIndices = nil
+	}
+	vertexCount := len(mesh.positions) / 3
+	indexCount := len(mesh.indices) + len(elementIndices)
+	if vertexCount == 0 || indexCount == 0 {
+		return nil, errors.New("Mesh has no vertices or indices")
+	}
+	data := make([][]float32, len(p.layout.attributes))
+	for i, a := range p.layout.attributes {
+		var err error
+		if data[i], err = meshAttributeData(mesh, a.Location); err != nil {
+			return nil, err
+		}
+	}
+	vertices, err := p.layout.Interleave(vertexCount, data...)
+	if err != nil {
+		return nil, err
+	}
+	indices := append(mesh.indices[:len(mesh.indices):len(mesh.indices)], elementIndices...)
+
+	firstVertex := p.allocate(&p.freeVertices, vertexCount, gl.ARRAY_BUFFER, &p.vertices, p.layout.stride)
+	firstIndex := p.allocate(&p.freeIndices, indexCount, gl.ELEMENT_ARRAY_BUFFER, &p.indices, poolIndexSize)
+	gl.BindBuffer(gl.ARRAY_BUFFER, p.vertices)
+	gl.BufferSubData(gl.ARRAY_BUFFER, firstVertex*p.layout.stride, len(vertices), gl.Ptr(vertices))
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	// The element buffer binding is part of the VAO, so the VAO of the pool is bound for the update
+	gl.BindVertexArray(p.vao)
+	gl.BufferSubData(gl.ELEMENT_ARRAY_BUFFER, firstIndex*poolIndexSize, len(indices)*poolIndexSize, gl.Ptr(indices))
+	gl.BindVertexArray(0)
+
+	m := &PooledMesh{
+		pool:        p,
+		firstVertex: int32(firstVertex),
+		vertexCount: int32(vertexCount),
+		firstIndex:  int32(firstIndex),
+		indexCount:  int32(indexCount),
+		parts:       modelParts(mesh.parts, int32(firstIndex), int32(firstIndex+len(mesh.indices))),
+		bounds:      computeAABB(mesh.positions),
+		sphere:      computeBoundingSphere(mesh.positions),
+	}
+	if len(m.parts) == 0 {
+		m.parts = []ModelPart{{submeshes: []Submesh{{offset: int32(firstIndex), count: int32(len(mesh.indices))}}}}
+	}
+	retainMaterials(m.parts)
+	return m, nil
+}
+
+// allocate allocates count elements of the given size from the buffer. If they don't fit, the buffer grows to at least
+// twice its size and the old data is copied over
+func (p *MeshPool) allocate(allocator *poolAllocator, count int, target uint32, buffer *uint32, size int) int {
+	if offset, ok := allocator.allocate(count); ok {
+		return offset
+	}
+	capacity := allocator.capacity * 2
+	if capacity < allocator.capacity+count {
+		capacity = allocator.capacity + count
+	}
+
+	var grown uint32
+	gl.GenBuffers(1, &grown)
+	gl.BindBuffer(gl.COPY_WRITE_BUFFER, grown)
+	gl.BufferData(gl.COPY_WRITE_BUFFER, capacity*size, nil, gl.DYNAMIC_DRAW)
+	gl.BindBuffer(gl.COPY_READ_BUFFER, *buffer)
+	gl.CopyBufferSubData(gl.COPY_READ_BUFFER, gl.COPY_WRITE_BUFFER, 0, 0, allocator.capacity*size)
+	gl.BindBuffer(gl.COPY_READ_BUFFER, 0)
+	gl.BindBuffer(gl.COPY_WRITE_BUFFER, 0)
+	gl.DeleteBuffers(1, buffer)
+	*buffer = grown
+
+	gl.BindVertexArray(p.vao)
+	if target == gl.ELEMENT_ARRAY_BUFFER {
+		gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, p.indices)
+	} else {
+		p.setAttributes()
+		gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	}
+	gl.BindVertexArray(0)
+
+	allocator.grow(capacity)
+	offset, _ := allocator.allocate(count)
+	return offset
+}
+
+// Remove frees the ranges of the mesh in the pool, which are reused by meshes added later, and deletes the textures of its
+// materials that no model or other pooled mesh uses. Draws of the mesh that are still queued in a renderer are dropped before its next draw
+func (p *MeshPool) Remove(m *PooledMesh) error {
+	if m.pool != p {
+		return errors.New("Mesh is not part of the pool")
+	}
+	p.freeVertices.release(int(m.firstVertex), int(m.vertexCount))
+	p.freeIndices.release(int(m.firstIndex), int(m.indexCount))
+	releaseMaterials(m.parts)
+	m.pool = nil
+	p.generation++
+	return nil
+}
+
+// Bind binds the VAO of the pool and enables the attributes of its layout. Attributes the layout doesn't have are white colors
+func (p *MeshPool) Bind() {
+	gl.BindVertexArray(p.vao)
+	hasColors := false
+	for _, a := range p.layout.attributes {
+		gl.EnableVertexAttribArray(a.Location)
+		hasColors = hasColors || a.Location == colorAttribute
+	}
+	if !hasColors {
+		gl.VertexAttrib4f(colorAttribute, 1.0, 1.0, 1.0, 1.0)
+	}
+	gl.VertexAttrib4f(instanceColorAttribute, 1.0, 1.0, 1.0, 1.0)
+}
+
+// Unbind disables the attributes and unbinds the VAO of the pool
+func (p *MeshPool) Unbind() {
+	for _, a := range p.layout.attributes {
+		gl.DisableVertexAttribArray(a.Location)
+	}
+	gl.BindVertexArray(0)
+}
+
+// Delete deletes the buffers of the pool. The textures of the materials of meshes that were not removed are not deleted
+func (p *MeshPool) Delete() {
+	gl.DeleteBuffers(1, &p.vertices)
+	gl.DeleteBuffers(1, &p.indices)
+	gl.DeleteVertexArrays(1, &p.vao)
+}
+
+// Bounds returns the bounding box of the mesh in model space
+func (m *PooledMesh) Bounds() AABB {
+	return m.bounds
+}
+
+// BoundingSphere returns the bounding sphere of the mesh in model space
+func (m *PooledMesh) BoundingSphere() BoundingSphere {
+	return m.sphere
+}
+
+// Part returns the first part of the mesh with the given name or nil if it has no such part. Parts can be hidden like the parts of a model
+func (m *PooledMesh) Part(name string) *ModelPart {
+	for i := range m.parts {
+		if m.parts[i].name == name {
+			return &m.parts[i]
+		}
+	}
+	return nil
+}
+
+// allocate takes count elements from the first free range that is large enough
+func (a *poolAllocator) allocate(count int) (int, bool) {
+	for i, r := range a.free {
+		if r.count < count {
+			continue
+		}
+		if r.count == count {
+			a.free = append(a.free[:i], a.free[i+1:]...)
+		} else {
+			a.free[i] = poolRange{r.offset + count, r.count - count}
+		}
+		return r.offset, true
+	}
+	return 0, false
+}
+
+// release returns a range and merges it with the free ranges next to it
+func (a *poolAllocator) release(offset, count int) {
+	if count == 0 {
+		return
+	}
+	i := sort.Search(len(a.free), func(i int) bool { return a.free[i].offset > offset })
+	a.free = append(a.free, poolRange{})
+	copy(a.free[i+1:], a.free[i:])
+	a.free[i] = poolRange{offset, count}
+	if i+1 < len(a.free) && a.free[i].offset+a.free[i].count == a.free[i+1].offset {
+		a.free[i].count += a.free[i+1].count
+		a.free = append(a.free[:i+1], a.free[i+2:]...)
+	}
+	if i > 0 && a.free[i-1].offset+a.free[i-1].count == a.free[i].offset {
+		a.free[i-1].count += a.free[i].count
+		a.free = append(a.free[:i], a.free[i+1:]...)
+	}
+}
+
+// grow adds the range between the old and the new capacity to the free ranges
+func (a *poolAllocator) grow(capacity int) {
+	a.release(a.capacity, capacity-a.capacity)
+	a.capacity = capacity
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPoolAllocator(t *testing.T) {
+	a := poolAllocator{}
+	a.grow(10)
+	first, _ := a.allocate(3)
+	second, _ := a.allocate(3)
+	third, _ := a.allocate(4)
+	if first != 0 || second != 3 || third != 6 || len(a.free) != 0 {
+		t.Fatalf("Allocated %d, %d and %d with the free ranges %v", first, second, third, a.free)
+	}
+	if _, ok := a.allocate(1); ok {
+		t.Fatal("Expected a full allocator")
+	}
+
+	// Released ranges are merged with their free neighbours
+	a.release(0, 3)
+	a.release(6, 4)
+	if !reflect.DeepEqual(a.free, []poolRange{{0, 3}, {6, 4}}) {
+		t.Fatalf("Free ranges %v", a.free)
+	}
+	// The first range that is large enough is used
+	if offset, ok := a.allocate(4); !ok || offset != 6 {
+		t.Fatalf("Allocated %d instead of 6", offset)
+	}
+	a.release(6, 4)
+	a.release(3, 3)
+	if !reflect.DeepEqual(a.free, []poolRange{{0, 10}}) {
+		t.Fatalf("Free ranges %v", a.free)
+	}
+
+	// Growing adds the new space to a free range at the end
+	a.allocate(8)
+	a.grow(20)
+	if !reflect.DeepEqual(a.free, []poolRange{{8, 12}}) || a.capacity != 20 {
+		t.Fatalf("Free ranges %v with a capacity of %d", a.free, a.capacity)
+	}
+	a.release(0, 0)
+	if !reflect.DeepEqual(a.free, []poolRange{{8, 12}}) {
+		t.Fatalf("Releasing nothing changed the free ranges to %v", a.free)
+	}
+}
@@ -1,189 +1,297 @@
 package main
 
 import (
-	"fmt"
 	_ "image/jpeg"
-	"io/ioutil"
-	"strconv"
-	"strings"
+	"math"
+	"unsafe"
 
 	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
 )
 
-// Model represents a model without texture information that has an index buffer
+// Model represents a model that has an index buffer and is optionally split into parts made of submeshes with their own material
 type Model struct {
-	vao      uint32
-	vbos     []uint32
-	indices  uint32
-	size     int32
-	textures []Texture
+	vao  uint32
+	vbos []uint32
+	// The size and usage of every buffer
+	buffers []vertexBuffer
+	// Attributes that read from ring buffers, which are not owned by the model
+	rings []ringAttribute
+	// The attribute location of every buffer
+	locations []uint32
+	indices   uint32
+	size      int32
+	// The OpenGL type of the indices and their size in bytes
+	indexType uint32
+	indexSize int
+	textures  []Texture
+	parts     []ModelPart
+	// The simplified levels of detail and the distances they are used from
+	lods         []modelLOD
+	lodDistances []float32
+	// The bounding volumes of the vertices in model space
+	bounds AABB
+	sphere BoundingSphere
+	// The primitives of a model without parts and the number of vertices of patches
+	mode          PrimitiveMode
+	patchVertices int32
 }
 
-// Delete deletes the model
+// Submesh represents a range of the index buffer of a model that is drawn with a single material
+type Submesh struct {
+	offset int32
+	count  int32
+	// The primitives of the submesh. Lines and points index into the elements of a mesh instead of its triangles
+	mode     PrimitiveMode
+	material *Material
+}
+
+// Delete deletes the model and the textures of its materials that no other model or pooled mesh uses
 func (m *Model) Delete() {
-	gl.DeleteBuffers(int32(len(m.vbos)), &m.vbos[0])
+	releaseMaterials(m.parts)
+	if len(m.vbos) > 0 {
+		gl.DeleteBuffers(int32(len(m.vbos)), &m.vbos[0])
+	}
 	gl.DeleteBuffers(1, &m.indices)
 	gl.DeleteVertexArrays(1, &m.vao)
 }
 
-// CreateModelFromFile loads an .obj file into a model
-func CreateModelFromFile(file string) (Model, error) {
-	fileData, err := ioutil.ReadFile(file)
+// The attribute locations of the vertex attributes of meshes. Models without colors use white
+const (
+	positionAttribute     = 0
+	textureCoordAttribute = 1
+	normalAttribute       = 2
+	colorAttribute        = 3
+	tangentAttribute      = 4
+)
+
+// CreateModelFromData creates a model from the provided vertex and index data and computes its bounding volumes. The RGBA vertex colors are optional and can be nil
+func CreateModelFromData(vertices []float32, indices []uint32, textureCoords []float32, normals []float32, colors []float32) (Model, error) {
+	model := NewModel()
+	model.AddBufferAndAttributeAt(positionAttribute, vertices, 3, false)
+	model.AddBufferAndAttributeAt(textureCoordAttribute, textureCoords, 2, false)
+	model.AddBufferAndAttributeAt(normalAttribute, normals, 3, true)
+	if len(colors) > 0 {
+		model.AddBufferAndAttributeAt(colorAttribute, colors, 4, false)
+	}
+	model.SetIndexBuffer(indices)
+	model.computeBounds(vertices)
+	return model, nil
+}
+
+// CreateModelFromMesh uploads the mesh to the GPU and loads the textures of its materials.
+// If a material has a bump map and the mesh has no tangents, they are generated first
+func CreateModelFromMesh(mesh *Mesh) (Model, error) {
+	if err := prepareMesh(mesh); err != nil {
+		return Model{}, err
+	}
+	model, err := CreateModelFromData(mesh.positions, modelIndices(mesh), mesh.textureCoords, mesh.normals, mesh.colors)
 	if err != nil {
-		return Model{0, nil, 0, 0, nil}, err
-	}
-	lines := strings.Split(string(fileData), "\n")
-	vertices := []float32{}
-	indices := []uint32{}
-	textureCoords := []float32{}
-	normals := []float32{}
-
-	realTextureCoords := []float32{}
-	realNormals := []float32{}
-
-	for _, l := range lines {
-		l = strings.Trim(l, "\r")
-		if strings.HasPrefix(l, "v ") {
-			lineParts := strings.Split(l, " ")
-			if len(lineParts) != 4 {
-				return Model{0, nil, 0, 0, nil}, fmt.Errorf("Invalid line in %s: %s", file, l)
-			}
-			for _, n := range lineParts[1:] {
-				f, err := strconv.ParseFloat(n, 32)
-				if err != nil {
-					return Model{0, nil, 0, 0, nil}, err
-				}
-				vertices = append(vertices, float32(f))
+		return Model{}, err
+	}
+	if len(mesh.tangents) > 0 {
+		model.AddBufferAndAttributeAt(tangentAttribute, mesh.tangents, 4, false)
+	}
+	model.setMesh(mesh)
+	return model, nil
+}
 
-			}
-		} else if strings.HasPrefix(l, "vt ") {
-			lineParts := strings.Split(l, " ")
-			if len(lineParts) != 3 {
-				return Model{0, nil, 0, 0, nil}, fmt.Errorf("Invalid line in %s: %s", file, l)
-			}
-			for _, n := range lineParts[1:] {
-				f, err := strconv.ParseFloat(n, 32)
-				if err != nil {
-					return Model{0, nil, 0, 0, nil}, err
+// prepareMesh loads the textures of the materials of the mesh and generates tangents if a material has a bump map
+func prepareMesh(mesh *Mesh) error {
+	for _, p := range mesh.parts {
+		for _, s := range p.submeshes {
+			if s.material != nil {
+				if err := s.material.LoadTextures(true); err != nil {
+					return err
 				}
-				textureCoords = append(textureCoords, float32(f))
-			}
-		} else if strings.HasPrefix(l, "vn ") {
-			lineParts := strings.Split(l, " ")
-			if len(lineParts) != 4 {
-				return Model{0, nil, 0, 0, nil}, fmt.Errorf("Invalid line in %s: %s", file, l)
-			}
-			for _, n := range lineParts[1:] {
-				f, err := strconv.ParseFloat(n, 32)
-				if err != nil {
-					return Model{0, nil, 0, 0, nil}, err
-				}
-				normals = append(normals, float32(f))
-			}
-		} else if strings.HasPrefix(l, "f ") {
-			if len(realNormals) == 0 && len(realTextureCoords) == 0 {
-				realNormals = make([]float32, len(vertices))
-				realTextureCoords = make([]float32, 2*len(vertices)/3)
-			}
-			lineParts := strings.Split(l, " ")
-			if len(lineParts) != 4 {
-				return Model{0, nil, 0, 0, nil}, fmt.Errorf("Invalid line in %s: Does not have four components %s", file, l)
 			}
+		}
+	}
+	if meshNeedsTangents(mesh) && len(mesh.tangents) == 0 {
+		return mesh.GenerateTangents()
+	}
+	return nil
+}
 
-			for _, p := range lineParts[1:] {
-				vertexData := strings.Split(p, "/")
-				if len(vertexData) != 3 {
-					return Model{0, nil, 0, 0, nil}, fmt.Errorf("Invalid line in %s: %s", file, l)
-				}
-				vertexIndex, err := strconv.ParseUint(vertexData[0], 10, 32)
-				if err != nil {
-					return Model{0, nil, 0, 0, nil}, fmt.Errorf("Invalid line in %s: %s", file, l)
-				}
-				vertexIndex--
-				texCoordIndex, err := strconv.ParseInt(vertexData[1], 10, 32)
-				if err != nil {
-					return Model{0, nil, 0, 0, nil}, fmt.Errorf("Invalid line in %s: %s", file, l)
-				}
-				texCoordIndex--
-				normalIndex, err := strconv.ParseInt(vertexData[2], 10, 32)
-				if err != nil {
-					return Model{0, nil, 0, 0, nil}, fmt.Errorf("Invalid line in %s: %s", file, l)
-				}
-				normalIndex--
-				indices = append(indices, uint32(vertexIndex))
-				realNormals[vertexIndex*3] = normals[normalIndex*3]
-				realNormals[vertexIndex*3+1] = normals[normalIndex*3+1]
-				realNormals[vertexIndex*3+2] = normals[normalIndex*3+2]
-				realTextureCoords[vertexIndex*2] = textureCoords[texCoordIndex*2]
-				realTextureCoords[vertexIndex*2+1] = 1 - textureCoords[texCoordIndex*2+1]
+// meshNeedsTangents checks if a material of the mesh has a bump map, which needs the tangents of the vertices
+func meshNeedsTangents(mesh *Mesh) bool {
+	for _, p := range mesh.parts {
+		for _, s := range p.submeshes {
+			if s.material != nil && s.material.bumpMap != "" {
+				return true
 			}
 		}
 	}
-	return CreateModelFromData(vertices, indices, realTextureCoords, realNormals)
+	return false
 }
 
-// CreateModelFromData creates a model from the provided vertex and index data
-func CreateModelFromData(vertices []float32, indices []uint32, textureCoords []float32, normals []float32) (Model, error) {
-	model := NewModel()
-	model.AddBufferAndAttribute3f(vertices, 3, false)
-	model.AddBufferAndAttribute3f(textureCoords, 2, false)
-	model.AddBufferAndAttribute3f(normals, 3, true)
-	model.SetIndexBuffer(indices)
-	return model, nil
+// setMesh takes the parts and levels of detail of the model from the uploaded mesh and counts the model as a user of its materials
+func (m *Model) setMesh(mesh *Mesh) {
+	m.parts = modelParts(mesh.parts, 0, int32(len(mesh.indices)))
+	retainMaterials(m.parts)
+	m.setLODs(mesh)
+	// The index buffer also holds the elements and the levels of detail, which are drawn through the parts and levels
+	m.size = int32(len(mesh.indices))
 }
 
 // NewModel creates a model with a VAO without any buffers
 func NewModel() Model {
-	model := Model{vao: 0, vbos: []uint32{}, size: 0, indices: 0, textures: []Texture{}}
+	model := Model{vao: 0, vbos: []uint32{}, locations: []uint32{}, size: 0, indices: 0, indexType: gl.UNSIGNED_INT, indexSize: 4, textures: []Texture{}}
 	gl.GenVertexArrays(1, &model.vao)
 	return model
 }
 
-// AddBufferAndAttribute3f adds a buffer containing the provided data and a corresponding vertex attribute
+// AddBufferAndAttribute3f adds a buffer containing the provided data and a corresponding vertex attribute.
+// The location of the attribute is the number of buffers added before
 func (m *Model) AddBufferAndAttribute3f(data []float32, numComponents int32, normalize bool) {
-	gl.BindVertexArray(m.vao)
-	var vbo uint32
-	gl.GenBuffers(1, &vbo)
-	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
-	gl.BufferData(gl.ARRAY_BUFFER, len(data)*4, gl.Ptr(data), gl.STATIC_DRAW)
-	gl.VertexAttribPointer(uint32(len(m.vbos)), numComponents, gl.FLOAT, normalize, 0, nil)
-	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
-	gl.BindVertexArray(0)
-	m.vbos = append(m.vbos, vbo)
+	m.AddBufferAndAttributeAt(uint32(len(m.vbos)), data, numComponents, normalize)
 }
 
-// SetIndexBuffer sets the index buffer of the model
+// AddBufferAndAttributeAt adds a buffer containing the provided data and a vertex attribute with the given location
+func (m *Model) AddBufferAndAttributeAt(location uint32, data []float32, numComponents int32, normalize bool) {
+	m.AddBufferWithUsage(location, data, numComponents, normalize, StaticBuffer)
+}
+
+// SetIndexBuffer sets the index buffer of the model. The indices are stored as bytes or shorts if the largest index fits
 func (m *Model) SetIndexBuffer(indices []uint32) {
 	gl.BindVertexArray(m.vao)
 	gl.GenBuffers(1, &m.indices)
 	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, m.indices)
-	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(indices)*4, gl.Ptr(indices), gl.STATIC_DRAW)
+	data, indexType, indexSize := packIndices(indices)
+	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(indices)*indexSize, data, gl.STATIC_DRAW)
 	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, 0)
 	gl.BindVertexArray(0)
 	m.size = int32(len(indices))
+	m.indexType, m.indexSize = indexType, indexSize
+}
 
+// packIndices converts the indices to the smallest type that holds the largest index. It returns a pointer to the converted
+// indices, which is nil if there are none, the OpenGL type and the size of an index in bytes
+func packIndices(indices []uint32) (unsafe.Pointer, uint32, int) {
+	if len(indices) == 0 {
+		return nil, gl.UNSIGNED_BYTE, 1
+	}
+	largest := uint32(0)
+	for _, index := range indices {
+		if index > largest {
+			largest = index
+		}
+	}
+	switch {
+	case largest <= math.MaxUint8:
+		packed := make([]uint8, len(indices))
+		for i, index := range indices {
+			packed[i] = uint8(index)
+		}
+		return gl.Ptr(packed), gl.UNSIGNED_BYTE, 1
+	case largest <= math.MaxUint16:
+		packed := make([]uint16, len(indices))
+		for i, index := range indices {
+			packed[i] = uint16(index)
+		}
+		return gl.Ptr(packed), gl.UNSIGNED_SHORT, 2
+	}
+	return gl.Ptr(indices), gl.UNSIGNED_INT, 4
 }
 
 // Bind binds all VAOs, vertex attributes textures and model uniforms
 func (m *Model) Bind(shader *ShaderProgram) {
 	gl.BindVertexArray(m.vao)
 	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, m.indices)
-	for i := range m.vbos {
-		gl.EnableVertexAttribArray(uint32(i))
+	hasColors := false
+	for _, location := range m.locations {
+		gl.EnableVertexAttribArray(location)
+		hasColors = hasColors || location == colorAttribute
+	}
+	m.bindRings()
+	if !hasColors {
+		gl.VertexAttrib4f(colorAttribute, 1.0, 1.0, 1.0, 1.0)
 	}
+	gl.VertexAttrib4f(instanceColorAttribute, 1.0, 1.0, 1.0, 1.0)
+	m.bindTextures(shader)
+}
+
+// bindTextures binds the textures added to the model and loads the default material uniforms
+func (m *Model) bindTextures(shader *ShaderProgram) {
 	for i, t := range m.textures {
 		t.Bind(i)
 	}
-	if len(m.textures) == 0 {
-		shader.LoadUniformFloat("hasTexture", 0.0)
-	} else {
+	loadDefaultMaterial(shader, len(m.textures) > 0)
+}
+
+// loadDefaultMaterial loads the material uniforms for drawing without a material
+func loadDefaultMaterial(shader *ShaderProgram, hasTexture bool) {
+	if hasTexture {
 		shader.LoadUniformFloat("hasTexture", 1.0)
+	} else {
+		shader.LoadUniformFloat("hasTexture", 0.0)
+	}
+	shader.LoadUniformVector("diffuseColor", mgl32.Vec3{1.0, 1.0, 1.0})
+	shader.LoadUniformFloat("hasNormalMap", 0.0)
+}
+
+// Draw draws all parts of the model that are not hidden to the screen. Submeshes with a material are drawn
+// with their own textures and uniforms. The shader should be already bound.
+func (m *Model) Draw(shader *ShaderProgram) {
+	m.drawLevel(shader, 0, 0)
+}
+
+// DrawPart draws a single part of the model, even if it is hidden. The model and the shader should be already bound.
+func (m *Model) DrawPart(shader *ShaderProgram, part *ModelPart) {
+	m.drawSubmeshes(shader, part.submeshes, 0)
+}
+
+// drawLevel draws all parts of the model that are not hidden with a level of detail, where 0 is the full model.
+// If instances is not 0, every draw call draws that many instances
+func (m *Model) drawLevel(shader *ShaderProgram, level int, instances int32) {
+	if level <= 0 || level > len(m.lods) {
+		if len(m.parts) == 0 {
+			m.drawElements(m.mode, m.size, 0, instances)
+			return
+		}
+		for i := range m.parts {
+			if !m.parts[i].hidden {
+				m.drawSubmeshes(shader, m.parts[i].submeshes, instances)
+			}
+		}
+		return
+	}
+	lod := &m.lods[level-1]
+	if len(m.parts) == 0 {
+		m.drawElements(m.mode, lod.count, lod.offset, instances)
+		return
+	}
+	for i := range m.parts {
+		if !m.parts[i].hidden {
+			m.drawSubmeshes(shader, lod.submeshes[i], instances)
+		}
 	}
 }
 
-// Draw draws the model to the screen. The shader should be already bound.
-func (m *Model) Draw() {
-	gl.DrawElements(gl.TRIANGLES, m.size, gl.UNSIGNED_INT, nil)
+// drawSubmeshes draws the submeshes with their materials
+func (m *Model) drawSubmeshes(shader *ShaderProgram, submeshes []Submesh, instances int32) {
+	for _, s := range submeshes {
+		if s.material != nil {
+			s.material.Bind(shader)
+		}
+		m.drawElements(s.mode, s.count, s.offset, instances)
+		if s.material != nil {
+			s.material.Unbind(shader)
+			m.bindTextures(shader)
+		}
+	}
+}
+
+// drawElements draws count indices of the index buffer starting at offset as the given primitives, instanced if instances is not 0
+func (m *Model) drawElements(mode PrimitiveMode, count, offset int32, instances int32) {
+	if mode == PrimitivePatches && m.patchVertices > 0 {
+		gl.PatchParameteri(gl.PATCH_VERTICES, m.patchVertices)
+	}
+	if instances == 0 {
+		gl.DrawElements(mode.glMode(), count, m.indexType, gl.PtrOffset(int(offset)*m.indexSize))
+		return
+	}
+	gl.DrawElementsInstanced(mode.glMode(), count, m.indexType, gl.PtrOffset(int(offset)*m.indexSize), instances)
 }
 
 // Unbind unbinds all model attributes and textures
@@ -191,8 +299,8 @@ func (m *Model) Unbind(shader *ShaderProgram) {
 	for i, t := range m.textures {
 		t.Unbind(i)
 	}
-	for i := range m.vbos {
-		gl.DisableVertexAttribArray(uint32(i))
+	for _, location := range m.locations {
+		gl.DisableVertexAttribArray(location)
 	}
 	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, 0)
 	gl.BindVertexArray(0)
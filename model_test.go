@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+func TestPackIndices(t *testing.T) {
+	tests := []struct {
+		indices   []uint32
+		indexType uint32
+		indexSize int
+	}{
+		{nil, gl.UNSIGNED_BYTE, 1},
+		{[]uint32{0, 1, 255}, gl.UNSIGNED_BYTE, 1},
+		{[]uint32{0, 256, 65535}, gl.UNSIGNED_SHORT, 2},
+		{[]uint32{65536, 0, 1}, gl.UNSIGNED_INT, 4},
+	}
+	for _, test := range tests {
+		data, indexType, indexSize := packIndices(test.indices)
+		if indexType != test.indexType || indexSize != test.indexSize {
+			t.Fatalf("%v: type %#x and size %d instead of %#x and %d", test.indices, indexType, indexSize, test.indexType, test.indexSize)
+		}
+		if len(test.indices) == 0 {
+			if data != nil {
+				t.Fatal("Expected no data without indices")
+			}
+			continue
+		}
+		unpacked := make([]uint32, len(test.indices))
+		for i := range unpacked {
+			switch indexSize {
+			case 1:
+				unpacked[i] = uint32(unsafe.Slice((*uint8)(data), len(unpacked))[i])
+			case 2:
+				unpacked[i] = uint32(unsafe.Slice((*uint16)(data), len(unpacked))[i])
+			case 4:
+				unpacked[i] = unsafe.Slice((*uint32)(data), len(unpacked))[i]
+			}
+		}
+		if !reflect.DeepEqual(unpacked, test.indices) {
+			t.Fatalf("Packed %v instead of %v", unpacked, test.indices)
+		}
+	}
+}
+
+func TestBufferUpdateErrors(t *testing.T) {
+	// The checks fail before any OpenGL call
+	model := Model{vbos: []uint32{1, 2}, buffers: []vertexBuffer{{16, StaticBuffer, false}, {64, StaticBuffer, true}}}
+	if err := model.UpdateBuffer(2, 0, []float32{1}); err == nil {
+		t.Error("Expected an error for a buffer that doesn't exist")
+	}
+	if err := model.UpdateBuffer(0, 3, []float32{1, 2}); err == nil {
+		t.Error("Expected an error for an update outside of the buffer")
+	}
+	if err := model.UpdateBuffer(1, 0, []float32{1}); err == nil {
+		t.Error("Expected an error for an update of an interleaved buffer")
+	}
+	if err := model.ReplaceBuffer(1, []float32{1}); err == nil {
+		t.Error("Expected an error for replacing an interleaved buffer")
+	}
+	if err := (&Model{parts: []ModelPart{{}}}).ReplaceIndices([]uint32{0, 1, 2}); err == nil {
+		t.Error("Expected an error for replacing the indices of a model with parts")
+	}
+	if err := (&Model{lods: []modelLOD{{}}}).ReplaceIndices([]uint32{0, 1, 2}); err == nil {
+		t.Error("Expected an error for replacing the indices of a model with levels of detail")
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// smoothNormals computes a normal for every vertex by averaging the normals of the triangles that use it, weighted by their area
+func smoothNormals(positions []float32, indices []uint32) []float32 {
+	normals := make([]float32, len(positions))
+	for i := 0; i+2 < len(indices); i += 3 {
+		a := mgl32.Vec3{positions[3*indices[i]], positions[3*indices[i]+1], positions[3*indices[i]+2]}
+		b := mgl32.Vec3{positions[3*indices[i+1]], positions[3*indices[i+1]+1], positions[3*indices[i+1]+2]}
+		c := mgl32.Vec3{positions[3*indices[i+2]], positions[3*indices[i+2]+1], positions[3*indices[i+2]+2]}
+		// The length of the cross product is twice the area of the triangle
+		normal := b.Sub(a).Cross(c.Sub(a))
+		for _, index := range indices[i : i+3] {
+			normals[3*index] += normal.X()
+			normals[3*index+1] += normal.Y()
+			normals[3*index+2] += normal.Z()
+		}
+	}
+	for i := 0; i+2 < len(normals); i += 3 {
+		normal := mgl32.Vec3{normals[i], normals[i+1], normals[i+2]}
+		if l := normal.Len(); l > 0 {
+			normal = normal.Mul(1 / l)
+		}
+		copy(normals[i:i+3], normal[:])
+	}
+	return normals
+}
+
+// NormalWeighting selects how the normals of the triangles around a vertex are weighted when they are averaged
+type NormalWeighting int
+
+const (
+	// WeightByArea lets large triangles contribute more than small ones
+	WeightByArea NormalWeighting = iota
+	// WeightByAngle weights every triangle by the angle of its corner at the vertex, which does not depend on how a surface is tessellated
+	WeightByAngle
+	// WeightByAreaAndAngle combines both weights
+	WeightByAreaAndAngle
+	// WeightUniform lets every triangle contribute the same, regardless of its size and shape
+	WeightUniform
+)
+
+// NormalOptions configures how missing normals are generated
+type NormalOptions struct {
+	Weighting NormalWeighting
+	// Triangles that meet at an angle of more than CreaseAngle degrees don't share normals, which keeps hard edges sharp.
+	// With 0, there is no limit and only smoothing groups separate triangles
+	CreaseAngle float32
+}
+
+// normalSmoothing describes which triangles and vertices of a mesh share normals when they are generated
+type normalSmoothing struct {
+	// The smoothing group of every triangle. Triangles only share normals with triangles of the same group,
+	// and triangles in group 0 are flat. If groups is nil, all triangles are in group 1
+	groups []uint32
+	// An id for the position of every vertex. Vertices with the same position id are smoothed together even though they
+	// are different vertices, e.g. on both sides of a UV seam. If positions is nil, every vertex has its own position
+	positions []uint32
+	// The vertices whose normals are kept. If keep is nil, all normals are generated
+	keep []bool
+}
+
+// generateNormals replaces the normals of the mesh. The normals of the triangles around a position are averaged if the triangles
+// are in the same smoothing group and meet at an angle of at most the crease angle. Vertices whose triangles end up with different
+// normals are split. Vertices that are not used by a triangle are removed
+func (m *Mesh) generateNormals(options NormalOptions, smoothing normalSmoothing) {
+	vertexCount := len(m.positions) / 3
+	triangleCount := len(m.indices) / 3
+	unitNormals := make([]mgl32.Vec3, triangleCount)
+	weights := make([]mgl32.Vec3, len(m.indices))
+	for t := 0; t < triangleCount; t++ {
+		corners := [3]mgl32.Vec3{m.position(m.indices[3*t]), m.position(m.indices[3*t+1]), m.position(m.indices[3*t+2])}
+		// The length of the cross product is twice the area of the triangle
+		normal := corners[1].Sub(corners[0]).Cross(corners[2].Sub(corners[0]))
+		if l := normal.Len(); l > 0 {
+			unitNormals[t] = normal.Mul(1 / l)
+		}
+		for c := 0; c < 3; c++ {
+			switch options.Weighting {
+			case WeightByArea:
+				weights[3*t+c] = normal
+			case WeightByAngle:
+				weights[3*t+c] = unitNormals[t].Mul(cornerAngle(corners, c))
+			case WeightByAreaAndAngle:
+				weights[3*t+c] = normal.Mul(cornerAngle(corners, c))
+			case WeightUniform:
+				weights[3*t+c] = unitNormals[t]
+			}
+		}
+	}
+
+	positionOf := func(v uint32) uint32 {
+		if smoothing.positions == nil {
+			return v
+		}
+		return smoothing.positions[v]
+	}
+	groupOf := func(corner int) uint32 {
+		if smoothing.groups == nil {
+			return 1
+		}
+		return smoothing.groups[corner/3]
+	}
+
+	// The corners of all triangles grouped by their position
+	positionCount := 0
+	for v := 0; v < vertexCount; v++ {
+		if p := int(positionOf(uint32(v))) + 1; p > positionCount {
+			positionCount = p
+		}
+	}
+	start := make([]int, positionCount+1)
+	for _, index := range m.indices {
+		start[positionOf(index)+1]++
+	}
+	for i := 0; i < positionCount; i++ {
+		start[i+1] += start[i]
+	}
+	corners := make([]int, len(m.indices))
+	next := append([]int{}, start[:positionCount]...)
+	for corner, index := range m.indices {
+		p := positionOf(index)
+		corners[next[p]] = corner
+		next[p]++
+	}
+
+	// All attributes except the normals are copied to split vertices
+	attributes := []meshFileAttribute{}
+	for _, attribute := range meshFileAttributes(m) {
+		if attribute.id != meshAttributeNormal && len(*attribute.data) > 0 {
+			attributes = append(attributes, attribute)
+		}
+	}
+
+	// Without a crease angle every pair of triangles passes the test. A small tolerance keeps coplanar triangles together
+	minCos := float32(-2)
+	if options.CreaseAngle > 0 {
+		minCos = float32(math.Cos(float64(mgl32.DegToRad(options.CreaseAngle)))) - 1e-6
+	}
+	// The corners around a position whose triangles have the same smoothing group and the same normal always share
+	// their normal, so the weights are summed per cluster and the crease angle is only tested between clusters
+	type cluster struct {
+		group  uint32
+		normal mgl32.Vec3
+	}
+	type split struct {
+		vertex uint32
+		normal mgl32.Vec3
+	}
+	splits := []split{}
+	splitIndices := map[split]int{}
+	cornerSplits := make([]int, len(m.indices))
+	clusterIndices := map[cluster]int{}
+	clusters := []cluster{}
+	clusterWeights := []mgl32.Vec3{}
+	clusterNormals := []mgl32.Vec3{}
+	groupClusters := map[uint32][]int{}
+	cornerClusters := make([]int, len(m.indices))
+	for p := 0; p < positionCount; p++ {
+		around := corners[start[p]:start[p+1]]
+		for key := range clusterIndices {
+			delete(clusterIndices, key)
+		}
+		for group := range groupClusters {
+			delete(groupClusters, group)
+		}
+		clusters, clusterWeights = clusters[:0], clusterWeights[:0]
+		for _, corner := range around {
+			key := cluster{groupOf(corner), unitNormals[corner/3]}
+			if key.group == 0 {
+				continue
+			}
+			i, ok := clusterIndices[key]
+			if !ok {
+				i = len(clusters)
+				clusterIndices[key] = i
+				clusters = append(clusters, key)
+				clusterWeights = append(clusterWeights, mgl32.Vec3{})
+				groupClusters[key.group] = append(groupClusters[key.group], i)
+			}
+			clusterWeights[i] = clusterWeights[i].Add(weights[corner])
+			cornerClusters[corner] = i
+		}
+
+		// Every cluster adds up the clusters of its group within the crease angle in the same order,
+		// so clusters with the same neighbours get exactly the same sum and equal normals can share a vertex.
+		// Without a crease angle all clusters of a group share the sum, which is only computed once
+		clusterNormals = clusterNormals[:0]
+		for i, c := range clusters {
+			group := groupClusters[c.group]
+			if options.CreaseAngle <= 0 && group[0] != i {
+				clusterNormals = append(clusterNormals, clusterNormals[group[0]])
+				continue
+			}
+			var normal mgl32.Vec3
+			for _, other := range group {
+				if other == i || c.normal.Dot(clusters[other].normal) >= minCos {
+					normal = normal.Add(clusterWeights[other])
+				}
+			}
+			if l := normal.Len(); l > 0 {
+				normal = normal.Mul(1 / l)
+			}
+			clusterNormals = append(clusterNormals, normal)
+		}
+
+		for _, corner := range around {
+			vertex := m.indices[corner]
+			var normal mgl32.Vec3
+			if smoothing.keep != nil && smoothing.keep[vertex] {
+				copy(normal[:], m.normals[3*vertex:3*vertex+3])
+			} else if groupOf(corner) != 0 {
+				normal = clusterNormals[cornerClusters[corner]]
+			} else {
+				// Flat triangles only use their own corners at the position, which is more than one corner for degenerate triangles
+				first := corner - corner%3
+				for other := first; other < first+3; other++ {
+					if positionOf(m.indices[other]) == uint32(p) {
+						normal = normal.Add(weights[other])
+					}
+				}
+				if l := normal.Len(); l > 0 {
+					normal = normal.Mul(1 / l)
+				}
+			}
+
+			key := split{vertex, normal}
+			found, ok := splitIndices[key]
+			if !ok {
+				found = len(splits)
+				splitIndices[key] = found
+				splits = append(splits, key)
+			}
+			cornerSplits[corner] = found
+		}
+	}
+
+	// The vertices are created in the order of their first use, like the vertices of the loaders
+	data := make([][]float32, len(attributes))
+	normals := make([]float32, 0, 3*len(splits))
+	indices := make([]uint32, len(m.indices))
+	created := make([]int64, len(splits))
+	for i := range created {
+		created[i] = -1
+	}
+	for corner, s := range cornerSplits {
+		if created[s] < 0 {
+			created[s] = int64(len(normals) / 3)
+			normals = append(normals, splits[s].normal[:]...)
+			vertex := int(splits[s].vertex)
+			for i, attribute := range attributes {
+				n := int(attribute.components)
+				data[i] = append(data[i], (*attribute.data)[vertex*n:(vertex+1)*n]...)
+			}
+		}
+		indices[corner] = uint32(created[s])
+	}
+
+	for i, attribute := range attributes {
+		*attribute.data = data[i]
+	}
+	m.normals = normals
+	m.indices = indices
+}
+
+// cornerAngle returns the angle of a triangle at the corner with the given index in radians
+func cornerAngle(corners [3]mgl32.Vec3, corner int) float32 {
+	a := corners[(corner+1)%3].Sub(corners[corner])
+	b := corners[(corner+2)%3].Sub(corners[corner])
+	if a.Len() == 0 || b.Len() == 0 {
+		return 0
+	}
+	return float32(math.Acos(clampf64(float64(a.Normalize().Dot(b.Normalize())), -1, 1)))
+}
+
+// position returns the position of a vertex
+func (m *Mesh) position(index uint32) mgl32.Vec3 {
+	return mgl32.Vec3{m.positions[3*index], m.positions[3*index+1], m.positions[3*index+2]}
+}
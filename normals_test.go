@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// testCubeOBJ returns a unit cube without normals. The smoothing statements are put before the first five faces and the top face
+func testCubeOBJ(smoothing, topSmoothing string) string {
+	return `v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+v 0 0 1
+v 1 0 1
+v 1 1 1
+v 0 1 1
+` + smoothing + `
+f 1 4 3 2
+f 1 2 6 5
+f 2 3 7 6
+f 3 4 8 7
+f 4 1 5 8
+` + topSmoothing + `
+f 5 6 7 8
+`
+}
+
+// testVecNear checks if the vectors are equal up to rounding errors. Unlike ApproxEqualThreshold, it also works for components near 0
+func testVecNear(a, b mgl32.Vec3) bool {
+	return a.Sub(b).Len() < 1e-5
+}
+
+// testCylinderOBJ returns a closed cylinder with n sides around the z axis without normals
+func testCylinderOBJ(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		angle := 2 * math.Pi * float64(i) / float64(n)
+		fmt.Fprintf(&b, "v %g %g 0\nv %g %g 1\n", math.Cos(angle), math.Sin(angle), math.Cos(angle), math.Sin(angle))
+	}
+	bottom, top := "f", "f"
+	for i := 0; i < n; i++ {
+		j := (i + 1) % n
+		fmt.Fprintf(&b, "f %d %d %d %d\n", 2*i+1, 2*j+1, 2*j+2, 2*i+2)
+		bottom += fmt.Sprintf(" %d", 2*(n-1-i)+1)
+		top += fmt.Sprintf(" %d", 2*i+2)
+	}
+	return b.String() + bottom + "\n" + top + "\n"
+}
+
+func TestGenerateNormalsCrease(t *testing.T) {
+	// Angle weighting makes the normals independent of how the faces are triangulated
+	smooth := NormalOptions{Weighting: WeightByAngle}
+	crease := func(angle float32) NormalOptions { return NormalOptions{Weighting: WeightByAngle, CreaseAngle: angle} }
+	tests := []struct {
+		name     string
+		obj      string
+		options  NormalOptions
+		vertices int
+		// The normals either all point away from the center of the cube or are all face normals
+		diagonal bool
+	}{
+		{"no crease angle", testCubeOBJ("", ""), smooth, 8, true},
+		{"crease angle", testCubeOBJ("", ""), crease(30), 24, false},
+		{"crease angle above the edges", testCubeOBJ("", ""), crease(100), 8, true},
+		{"smoothing off", testCubeOBJ("s off", ""), smooth, 24, false},
+		{"smoothing group 0", testCubeOBJ("s 0", ""), smooth, 24, false},
+		{"smoothing group 0 with a crease angle", testCubeOBJ("s 0", "s 0"), crease(100), 24, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mesh, err := ParseOBJWithOptions(strings.NewReader(test.obj), "", ObjOptions{Normals: test.options})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mesh.positions) != 3*test.vertices || len(mesh.normals) != 3*test.vertices {
+				t.Fatalf("%d vertices instead of %d", len(mesh.positions)/3, test.vertices)
+			}
+			for v := 0; v < test.vertices; v++ {
+				normal := mgl32.Vec3{mesh.normals[3*v], mesh.normals[3*v+1], mesh.normals[3*v+2]}
+				outwards := testPosition(&mesh, uint32(v)).Sub(mgl32.Vec3{0.5, 0.5, 0.5})
+				if test.diagonal && !testVecNear(normal, outwards.Normalize()) {
+					t.Fatalf("Normal %v of vertex %d is not diagonal", normal, v)
+				}
+				// Face normals have a single non-zero component
+				if !test.diagonal && (normal.Len() != 1 || normal.Dot(outwards) != 0.5) {
+					t.Fatalf("Normal %v of vertex %d is not a face normal", normal, v)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateNormalsSmoothingGroups(t *testing.T) {
+	mesh, err := ParseOBJWithOptions(strings.NewReader(testCubeOBJ("s 1", "s 2")), "", ObjOptions{Normals: NormalOptions{Weighting: WeightByAngle}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The top face is in its own group, so its four corners are split from the sides
+	if len(mesh.positions) != 3*12 {
+		t.Fatalf("%d vertices instead of 12", len(mesh.positions)/3)
+	}
+	top := 0
+	for v := 0; v < 12; v++ {
+		if normal := (mgl32.Vec3{mesh.normals[3*v], mesh.normals[3*v+1], mesh.normals[3*v+2]}); normal == (mgl32.Vec3{0, 0, 1}) {
+			top++
+		} else if normal.Z() > 0 {
+			t.Fatalf("Normal %v of vertex %d is smoothed with the top face", normal, v)
+		}
+	}
+	if top != 4 {
+		t.Fatalf("%d vertices with the normal of the top face", top)
+	}
+	if _, err := ParseOBJ(strings.NewReader("s x\n")); err == nil {
+		t.Fatal("Expected an error for an invalid smoothing group")
+	}
+}
+
+func TestGenerateNormalsCylinder(t *testing.T) {
+	const sides = 16
+	options := NormalOptions{Weighting: WeightByAngle, CreaseAngle: 60}
+	mesh, err := ParseOBJWithOptions(strings.NewReader(testCylinderOBJ(sides)), "", ObjOptions{Normals: options})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The sides meet at 22.5 degrees and are smooth, the caps meet them at 90 degrees and get their own vertices
+	if len(mesh.positions) != 3*4*sides {
+		t.Fatalf("%d vertices instead of %d", len(mesh.positions)/3, 4*sides)
+	}
+	sideVertices := 0
+	for v := 0; v < len(mesh.positions)/3; v++ {
+		position := testPosition(&mesh, uint32(v))
+		normal := mgl32.Vec3{mesh.normals[3*v], mesh.normals[3*v+1], mesh.normals[3*v+2]}
+		if normal.Z() == 0 {
+			sideVertices++
+			if radial := (mgl32.Vec3{position.X(), position.Y(), 0}); !testVecNear(normal, radial) {
+				t.Fatalf("Side normal %v at %v is not radial", normal, position)
+			}
+		} else if normal != (mgl32.Vec3{0, 0, 2*position.Z() - 1}) {
+			t.Fatalf("Cap normal %v at %v", normal, position)
+		}
+	}
+	if sideVertices != 2*sides {
+		t.Fatalf("%d side vertices instead of %d", sideVertices, 2*sides)
+	}
+}
+
+func TestGenerateNormalsWeighting(t *testing.T) {
+	// A large triangle with a right angle at the origin and a small one with an angle of 45 degrees there
+	positions := []float32{0, 0, 0, 4, 0, 0, 0, 4, 0, 0, 1, 0, 0, 1, 1}
+	tests := []struct {
+		weighting NormalWeighting
+		normal    mgl32.Vec3
+	}{
+		// The cross products have the lengths 16 and 1
+		{WeightByArea, mgl32.Vec3{1, 0, 16}},
+		{WeightByAngle, mgl32.Vec3{math.Pi / 4, 0, math.Pi / 2}},
+		{WeightByAreaAndAngle, mgl32.Vec3{math.Pi / 4, 0, 16 * math.Pi / 2}},
+		{WeightUniform, mgl32.Vec3{1, 0, 1}},
+	}
+	for _, test := range tests {
+		mesh := Mesh{positions: append([]float32{}, positions...), indices: []uint32{0, 1, 2, 0, 3, 4}}
+		mesh.generateNormals(NormalOptions{Weighting: test.weighting}, normalSmoothing{})
+		origin := mesh.indices[0]
+		normal := mgl32.Vec3{mesh.normals[3*origin], mesh.normals[3*origin+1], mesh.normals[3*origin+2]}
+		if mesh.indices[3] != origin || !testVecNear(normal, test.normal.Normalize()) {
+			t.Errorf("Weighting %d: normal %v instead of %v", test.weighting, normal, test.normal.Normalize())
+		}
+	}
+}
+
+func TestGenerateNormalsFan(t *testing.T) {
+	// A cone with many sides, whose tip is shared by all triangles. With the crease angle the tip splits into one vertex per side
+	const sides = 2000
+	for _, test := range []struct {
+		creaseAngle float32
+		tips        int
+	}{{0, 1}, {1, sides}} {
+		mesh := Mesh{positions: []float32{0, 0, 1}}
+		for i := 0; i < sides; i++ {
+			a := 2 * math.Pi * float64(i) / sides
+			mesh.positions = append(mesh.positions, float32(math.Cos(a)), float32(math.Sin(a)), 0)
+			mesh.indices = append(mesh.indices, 0, uint32(1+i), uint32(1+(i+1)%sides))
+		}
+		mesh.generateNormals(NormalOptions{CreaseAngle: test.creaseAngle}, normalSmoothing{})
+		tips := map[uint32]bool{}
+		for i := 0; i < len(mesh.indices); i += 3 {
+			tips[mesh.indices[i]] = true
+		}
+		if len(tips) != test.tips {
+			t.Errorf("Crease angle %v: %d vertices at the tip instead of %d", test.creaseAngle, len(tips), test.tips)
+		}
+		if tip := mesh.indices[0]; test.tips == 1 && !testVecNear(mgl32.Vec3{mesh.normals[3*tip], mesh.normals[3*tip+1], mesh.normals[3*tip+2]}, mgl32.Vec3{0, 0, 1}) {
+			t.Errorf("The smooth tip has the normal %v", mesh.normals[3*tip:3*tip+3])
+		}
+	}
+}
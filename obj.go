@@ -0,0 +1,629 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// ObjOptions configures how .obj files are loaded
+type ObjOptions struct {
+	// CollectErrors continues after invalid lines and returns all of them as ParseErrors instead of stopping at the first one
+	CollectErrors bool
+	// SizeHint is the approximate size of the input in bytes and is used to preallocate the mesh buffers.
+	// LoadOBJ uses the size of the file if it is not set
+	SizeHint int64
+	// Workers is the number of goroutines that parse the file in parallel. Values below 2 select the sequential
+	// parser, which streams the input instead of reading it into memory
+	Workers int
+	// CacheDir enables the mesh cache of LoadOBJ. Parsed files are stored in the binary mesh format in this directory
+	// and loaded from there as long as the .obj file and its material libraries do not change
+	CacheDir string
+	// Normals configures the generation of normals for faces without vn indices
+	Normals NormalOptions
+	// Optimize reorders the triangles and vertices of the mesh for rendering after parsing if it is not nil
+	Optimize *OptimizeOptions
+	// Optimized is called with the cache efficiency before and after the mesh was optimized. Meshes loaded from
+	// the mesh cache were optimized when they were cached, so it is not called for them
+	Optimized func(stats OptimizeStats)
+	// Warnings is called for problems that don't stop loading, like missing material libraries or unknown materials.
+	// Submeshes without a known material are drawn without one. If Warnings is nil, the problems are logged
+	Warnings func(warning *ParseError)
+}
+
+// Roughly the number of bytes per vertex of a typical .obj file with two triangles per vertex
+const objBytesPerVertex = 100
+
+// The maximum length of a single line
+const objMaxLineLength = 16 * 1024 * 1024
+
+// objParser holds the state of an .obj file while it is parsed line by line
+type objParser struct {
+	file string
+
+	// The current line. The fields point into the buffer of the scanner and are only valid until the next line is read
+	line    int
+	fields  []string
+	columns []int
+
+	// Buffers that are reused for every face
+	faceVertices []objVertexKey
+	polygon      []mgl32.Vec3
+
+	vertices      []float32
+	textureCoords []float32
+	normals       []float32
+
+	// Every unique combination of position, texture coordinate and normal becomes its own vertex
+	uniqueVertices    map[objVertexKey]uint32
+	realVertices      []float32
+	realTextureCoords []float32
+	realNormals       []float32
+	indices           []uint32
+
+	// Lines and points get their own vertices once the triangles are done, since they don't take part in generating normals
+	elements        []objElement
+	elementVertices []objVertexKey
+
+	// Normals of vertices without a vn index are generated after all faces were read.
+	// The smoothing group of every triangle decides which triangles share normals
+	missingNormals  bool
+	smoothingGroup  uint32
+	smoothingGroups []uint32
+	normalOptions   NormalOptions
+	optimizeOptions *OptimizeOptions
+	optimized       func(stats OptimizeStats)
+	warnings        func(warning *ParseError)
+
+	// A new submesh is started whenever the material changes and a new part for every object and group
+	materials       map[string]*Material
+	currentMaterial *Material
+	currentObject   string
+	parts           []ModelPart
+	libraries       []string
+}
+
+// objVertexKey identifies a face vertex of an .obj file by its zero based position, texture coordinate and normal indices.
+// Texture coordinate and normal are -1 if the face vertex does not reference them
+type objVertexKey struct {
+	position int64
+	texCoord int64
+	normal   int64
+}
+
+// objElement is a polyline or a list of points of an .obj file. Its vertices are the range from first in elementVertices
+type objElement struct {
+	mode         PrimitiveMode
+	part         int
+	material     *Material
+	first, count int
+}
+
+// CreateModelFromFile loads an .obj file into a model
+func CreateModelFromFile(file string) (Model, error) {
+	return CreateModelFromFileWithOptions(file, ObjOptions{})
+}
+
+// CreateModelFromFileWithOptions loads an .obj file into a model using the provided options
+func CreateModelFromFileWithOptions(file string, options ObjOptions) (Model, error) {
+	mesh, err := LoadOBJ(file, options)
+	if err != nil {
+		return Model{}, err
+	}
+	return CreateModelFromMesh(&mesh)
+}
+
+// LoadOBJ parses an .obj file into a mesh without uploading it
+func LoadOBJ(file string, options ObjOptions) (Mesh, error) {
+	if options.CacheDir != "" {
+		return loadCachedOBJ(file, options)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return Mesh{}, err
+	}
+	defer f.Close()
+	if options.SizeHint == 0 {
+		if info, err := f.Stat(); err == nil {
+			options.SizeHint = info.Size()
+		}
+	}
+	return ParseOBJWithOptions(f, file, options)
+}
+
+// ParseOBJ parses .obj data into a mesh. Material libraries are resolved relative to the working directory
+func ParseOBJ(r io.Reader) (Mesh, error) {
+	return ParseOBJWithOptions(r, "", ObjOptions{})
+}
+
+// ParseOBJWithOptions parses .obj data into a mesh. The file name is used for error messages and
+// material libraries are resolved relative to its directory. The data is streamed line by line,
+// so the memory usage only depends on the size of the resulting mesh
+func ParseOBJWithOptions(r io.Reader, file string, options ObjOptions) (Mesh, error) {
+	if options.Workers > 1 {
+		return parseOBJParallel(r, file, options)
+	}
+
+	p := newObjParser(file)
+	p.normalOptions = options.Normals
+	p.optimizeOptions = options.Optimize
+	p.optimized = options.Optimized
+	p.warnings = options.Warnings
+	p.preallocate(int(options.SizeHint / objBytesPerVertex))
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), objMaxLineLength)
+	errs := ParseErrors{}
+	for line := 1; scanner.Scan(); line++ {
+		err := p.parseLine(line, bytesToString(scanner.Bytes()))
+		if err := collectParseError(err, options, &errs); err != nil {
+			return Mesh{}, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Mesh{}, err
+	}
+	if len(errs) > 0 {
+		return Mesh{}, errs
+	}
+	return p.finish(), nil
+}
+
+// collectParseError adds a parse error to errs if errors are collected. It returns the error if parsing should stop
+func collectParseError(err error, options ObjOptions, errs *ParseErrors) error {
+	if err == nil {
+		return nil
+	}
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		return err
+	}
+	if !options.CollectErrors {
+		return parseErr
+	}
+	*errs = append(*errs, parseErr)
+	return nil
+}
+
+// newObjParser creates a parser for the .obj file with the given name. The name is used for error messages and to find material libraries
+func newObjParser(file string) *objParser {
+	return &objParser{
+		file:           file,
+		uniqueVertices: map[objVertexKey]uint32{},
+		smoothingGroup: objDefaultSmoothingGroup,
+		materials:      map[string]*Material{},
+		parts:          []ModelPart{{submeshes: []Submesh{{}}}},
+	}
+}
+
+// preallocate reserves space for the expected number of vertices
+func (p *objParser) preallocate(vertices int) {
+	if vertices <= 0 {
+		return
+	}
+	p.vertices = make([]float32, 0, vertices*3)
+	p.normals = make([]float32, 0, vertices*3)
+	p.textureCoords = make([]float32, 0, vertices*2)
+	p.uniqueVertices = make(map[objVertexKey]uint32, vertices)
+	p.realVertices = make([]float32, 0, vertices*3)
+	p.realTextureCoords = make([]float32, 0, vertices*2)
+	p.realNormals = make([]float32, 0, vertices*3)
+	p.indices = make([]uint32, 0, vertices*6)
+	p.smoothingGroups = make([]uint32, 0, vertices*2)
+}
+
+// bytesToString converts a byte slice to a string without copying it. The string is only valid as long as the slice is not modified
+func bytesToString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}
+
+// errorAt creates a ParseError for the field with the given index of the current line. Use -1 if the whole line is invalid
+func (p *objParser) errorAt(field int, reason string, err error) *ParseError {
+	parseErr := &ParseError{File: p.file, Line: p.line, Reason: reason, Err: err}
+	// The fields point into the buffer of the scanner, so the token has to be copied
+	if field >= 0 && field < len(p.fields) {
+		parseErr.Column = p.columns[field]
+		parseErr.Token = strings.Clone(p.fields[field])
+	} else {
+		parseErr.Token = strings.Clone(strings.Join(p.fields, " "))
+	}
+	return parseErr
+}
+
+// warn reports a problem that doesn't stop parsing
+func (p *objParser) warn(warning *ParseError) {
+	if p.warnings != nil {
+		p.warnings(warning)
+		return
+	}
+	log.Print("Warning: ", warning)
+}
+
+// parseFloats parses the fields from start to end of the current line into dst
+func (p *objParser) parseFloats(dst []float32, start, end int) error {
+	for i := start; i < end; i++ {
+		f, err := strconv.ParseFloat(p.fields[i], 32)
+		if err != nil {
+			return p.errorAt(i, "Invalid number", err)
+		}
+		dst[i-start] = float32(f)
+	}
+	return nil
+}
+
+// parseLine parses a single line of the file
+func (p *objParser) parseLine(line int, l string) error {
+	p.line = line
+	p.fields, p.columns = splitFields(l, p.fields[:0], p.columns[:0])
+	return p.parseFields()
+}
+
+// parseFields parses the fields of the current line
+func (p *objParser) parseFields() error {
+	if len(p.fields) == 0 {
+		return nil
+	}
+	switch p.fields[0] {
+	case "v":
+		// Additional components like w or vertex colors are ignored
+		if len(p.fields) < 4 {
+			return p.errorAt(-1, "Vertex needs at least three components", nil)
+		}
+		var position [3]float32
+		if err := p.parseFloats(position[:], 1, 4); err != nil {
+			return err
+		}
+		p.vertices = append(p.vertices, position[:]...)
+	case "vt":
+		// The v component is optional and defaults to 0, w is ignored
+		if len(p.fields) < 2 || len(p.fields) > 4 {
+			return p.errorAt(-1, "Texture coordinate needs one to three components", nil)
+		}
+		var texCoord [3]float32
+		if err := p.parseFloats(texCoord[:], 1, len(p.fields)); err != nil {
+			return err
+		}
+		p.textureCoords = append(p.textureCoords, texCoord[:2]...)
+	case "vn":
+		if len(p.fields) != 4 {
+			return p.errorAt(-1, "Normal needs three components", nil)
+		}
+		var normal [3]float32
+		if err := p.parseFloats(normal[:], 1, 4); err != nil {
+			return err
+		}
+		p.normals = append(p.normals, normal[:]...)
+	case "mtllib":
+		for i, library := range p.fields[1:] {
+			path := filepath.Join(filepath.Dir(p.file), library)
+			libraryMaterials, err := LoadMaterialLibrary(path)
+			if err != nil {
+				p.warn(p.errorAt(i+1, "Could not load material library", err))
+				continue
+			}
+			p.libraries = append(p.libraries, path)
+			for name, material := range libraryMaterials {
+				p.materials[name] = material
+			}
+		}
+	case "usemtl":
+		var material *Material
+		if len(p.fields) != 2 {
+			p.warn(p.errorAt(-1, "Expected a single material name", nil))
+		} else if material = p.materials[p.fields[1]]; material == nil {
+			p.warn(p.errorAt(1, "Unknown material", nil))
+		}
+		closeSubmesh(p.parts, int32(len(p.indices)))
+		p.currentMaterial = material
+		p.parts[len(p.parts)-1].submeshes = append(p.parts[len(p.parts)-1].submeshes, Submesh{offset: int32(len(p.indices)), material: material})
+	case "o", "g":
+		name := strings.Clone(strings.Join(p.fields[1:], " "))
+		if p.fields[0] == "o" {
+			p.currentObject = name
+		}
+		closeSubmesh(p.parts, int32(len(p.indices)))
+		p.removeEmptyPart()
+		p.parts = append(p.parts, ModelPart{
+			name:      name,
+			object:    p.currentObject,
+			submeshes: []Submesh{{offset: int32(len(p.indices)), material: p.currentMaterial}},
+		})
+	case "s":
+		if len(p.fields) != 2 {
+			return p.errorAt(-1, "Expected a single smoothing group", nil)
+		}
+		if p.fields[1] == "off" {
+			p.smoothingGroup = 0
+			break
+		}
+		group, err := strconv.ParseUint(p.fields[1], 10, 32)
+		if err != nil {
+			return p.errorAt(1, "Invalid smoothing group", err)
+		}
+		p.smoothingGroup = uint32(group)
+	case "f":
+		return p.parseFace(p.counts())
+	case "l", "p":
+		return p.parseElement(p.counts())
+	}
+	return nil
+}
+
+// objCounts holds the number of positions, texture coordinates and normals that were read up to a line
+type objCounts struct {
+	vertices      int
+	textureCoords int
+	normals       int
+}
+
+// counts returns the number of elements read so far
+func (p *objParser) counts() objCounts {
+	return objCounts{len(p.vertices) / 3, len(p.textureCoords) / 2, len(p.normals) / 3}
+}
+
+// parseFace parses a face of the current line and adds it to the mesh. Negative indices are resolved relative to counts
+func (p *objParser) parseFace(counts objCounts) error {
+	if len(p.fields) < 4 {
+		return p.errorAt(-1, "Face needs at least three vertices", nil)
+	}
+
+	faceVertices := p.faceVertices[:0]
+	for i, s := range p.fields[1:] {
+		raw, err := parseObjFaceVertex(s)
+		if err != nil {
+			return p.errorAt(i+1, "Invalid face vertex", err)
+		}
+		key, err := raw.resolve(counts)
+		if err != nil {
+			return p.errorAt(i+1, "Invalid face vertex", err)
+		}
+		faceVertices = append(faceVertices, key)
+	}
+	p.faceVertices = faceVertices
+	p.addFace(faceVertices)
+	return nil
+}
+
+// parseElement parses the line or the points of the current line. Negative indices are resolved relative to counts
+func (p *objParser) parseElement(counts objCounts) error {
+	element := objElement{mode: PrimitiveLines, part: len(p.parts) - 1, material: p.currentMaterial, first: len(p.elementVertices)}
+	if p.fields[0] == "p" {
+		element.mode = PrimitivePoints
+		if len(p.fields) < 2 {
+			return p.errorAt(-1, "Point needs at least one vertex", nil)
+		}
+	} else if len(p.fields) < 3 {
+		return p.errorAt(-1, "Line needs at least two vertices", nil)
+	}
+
+	for i, s := range p.fields[1:] {
+		raw, err := parseObjFaceVertex(s)
+		if err == nil {
+			var key objVertexKey
+			if key, err = raw.resolve(counts); err == nil {
+				p.elementVertices = append(p.elementVertices, key)
+				continue
+			}
+		}
+		p.elementVertices = p.elementVertices[:element.first]
+		return p.errorAt(i+1, "Invalid element vertex", err)
+	}
+	element.count = len(p.elementVertices) - element.first
+	p.elements = append(p.elements, element)
+	return nil
+}
+
+// removeEmptyPart removes the last part if it has neither triangles nor lines and points
+func (p *objParser) removeEmptyPart() {
+	if len(p.elements) == 0 || p.elements[len(p.elements)-1].part != len(p.parts)-1 {
+		p.parts = removeEmptyPart(p.parts)
+	}
+}
+
+// addFace splits a face into triangles and appends them to the index buffer
+func (p *objParser) addFace(faceVertices []objVertexKey) {
+	polygon := p.polygon[:0]
+	for _, key := range faceVertices {
+		polygon = append(polygon, mgl32.Vec3{p.vertices[key.position*3], p.vertices[key.position*3+1], p.vertices[key.position*3+2]})
+	}
+	p.polygon = polygon
+
+	// Faces with more than three vertices are split into triangles
+	triangles := singleTriangle
+	if len(polygon) > 3 {
+		triangles = triangulatePolygon(polygon)
+	}
+	for _, triangle := range triangles {
+		p.smoothingGroups = append(p.smoothingGroups, p.smoothingGroup)
+		for _, corner := range triangle {
+			key := faceVertices[corner]
+			index, ok := p.uniqueVertices[key]
+			if !ok {
+				index = uint32(len(p.realVertices) / 3)
+				p.uniqueVertices[key] = index
+				p.realVertices = append(p.realVertices, p.vertices[key.position*3:key.position*3+3]...)
+				if key.texCoord < 0 {
+					p.realTextureCoords = append(p.realTextureCoords, 0, 0)
+				} else {
+					p.realTextureCoords = append(p.realTextureCoords, p.textureCoords[key.texCoord*2], 1-p.textureCoords[key.texCoord*2+1])
+				}
+				if key.normal < 0 {
+					p.missingNormals = true
+					p.realNormals = append(p.realNormals, 0, 0, 0)
+				} else {
+					p.realNormals = append(p.realNormals, p.normals[key.normal*3:key.normal*3+3]...)
+				}
+			}
+			p.indices = append(p.indices, index)
+		}
+	}
+}
+
+// finish closes the last submesh, generates missing normals and returns the mesh after all lines have been parsed
+func (p *objParser) finish() Mesh {
+	closeSubmesh(p.parts, int32(len(p.indices)))
+	p.removeEmptyPart()
+	mesh := Mesh{
+		positions:     p.realVertices,
+		textureCoords: p.realTextureCoords,
+		normals:       p.realNormals,
+		indices:       p.indices,
+		parts:         p.parts,
+
+		materialLibraries: p.libraries,
+	}
+	if p.missingNormals {
+		p.generateNormals(&mesh)
+	}
+	if p.optimizeOptions != nil {
+		stats := mesh.Optimize(*p.optimizeOptions)
+		if p.optimized != nil {
+			p.optimized(stats)
+		}
+	}
+	p.addElements(&mesh)
+	return mesh
+}
+
+// addElements appends the vertices of the lines and points to the mesh and adds their submeshes to the parts.
+// Polylines are split into separate segments
+func (p *objParser) addElements(mesh *Mesh) {
+	uniqueVertices := map[objVertexKey]uint32{}
+	vertex := func(key objVertexKey) uint32 {
+		index, ok := uniqueVertices[key]
+		if !ok {
+			index = uint32(len(mesh.positions) / 3)
+			uniqueVertices[key] = index
+			mesh.positions = append(mesh.positions, p.vertices[key.position*3:key.position*3+3]...)
+			if key.texCoord < 0 {
+				mesh.textureCoords = append(mesh.textureCoords, 0, 0)
+			} else {
+				mesh.textureCoords = append(mesh.textureCoords, p.textureCoords[key.texCoord*2], 1-p.textureCoords[key.texCoord*2+1])
+			}
+			if key.normal < 0 {
+				mesh.normals = append(mesh.normals, 0, 0, 0)
+			} else {
+				mesh.normals = append(mesh.normals, p.normals[key.normal*3:key.normal*3+3]...)
+			}
+		}
+		return index
+	}
+
+	for _, e := range p.elements {
+		offset := int32(len(mesh.elementIndices))
+		vertices := p.elementVertices[e.first : e.first+e.count]
+		if e.mode == PrimitivePoints {
+			for _, key := range vertices {
+				mesh.elementIndices = append(mesh.elementIndices, vertex(key))
+			}
+		} else {
+			for i := 1; i < len(vertices); i++ {
+				mesh.elementIndices = append(mesh.elementIndices, vertex(vertices[i-1]), vertex(vertices[i]))
+			}
+		}
+
+		// Consecutive elements of a part with the same material share a submesh
+		part := &mesh.parts[e.part]
+		if n := len(part.submeshes); n > 0 {
+			last := &part.submeshes[n-1]
+			if last.mode == e.mode && last.material == e.material && last.offset+last.count == offset {
+				last.count = int32(len(mesh.elementIndices)) - last.offset
+				continue
+			}
+		}
+		part.submeshes = append(part.submeshes, Submesh{offset: offset, count: int32(len(mesh.elementIndices)) - offset, mode: e.mode, material: e.material})
+	}
+}
+
+// generateNormals generates the normals of the mesh for faces without vn indices
+func (p *objParser) generateNormals(mesh *Mesh) {
+	// Vertices that only differ in their texture coordinates share the position of the file, so normals are smooth across UV seams
+	smoothing := normalSmoothing{
+		groups:    p.smoothingGroups,
+		positions: make([]uint32, len(p.realVertices)/3),
+		keep:      make([]bool, len(p.realVertices)/3),
+	}
+	for key, index := range p.uniqueVertices {
+		smoothing.positions[index] = uint32(key.position)
+		smoothing.keep[index] = key.normal >= 0
+	}
+	mesh.generateNormals(p.normalOptions, smoothing)
+}
+
+// Faces before the first s statement are smoothed together, as if they were in a smoothing group
+const objDefaultSmoothingGroup = math.MaxUint32
+
+// singleTriangle is the triangulation of a face with three vertices. It must not be modified
+var singleTriangle = [][3]int{{0, 1, 2}}
+
+// objMissingIndex marks a texture coordinate or normal that is not referenced by a face vertex
+const objMissingIndex = math.MinInt64
+
+// objRawVertex holds the position, texture coordinate and normal indices of a face vertex as written in the file
+type objRawVertex [3]int64
+
+// parseObjFaceVertex parses a face vertex of the form v, v/vt, v//vn or v/vt/vn
+func parseObjFaceVertex(s string) (objRawVertex, error) {
+	raw := objRawVertex{objMissingIndex, objMissingIndex, objMissingIndex}
+	position, rest, _ := strings.Cut(s, "/")
+	texCoord, normal, _ := strings.Cut(rest, "/")
+	if strings.Contains(normal, "/") {
+		return raw, fmt.Errorf("Too many components in face vertex %s", s)
+	}
+	for i, index := range [3]string{position, texCoord, normal} {
+		if i > 0 && index == "" {
+			continue
+		}
+		var err error
+		if raw[i], err = strconv.ParseInt(index, 10, 32); err != nil {
+			return raw, err
+		}
+	}
+	return raw, nil
+}
+
+// resolve converts the one based or negative relative indices into zero based indices.
+// The counts are the number of elements read up to the face and are used to resolve negative indices
+func (raw objRawVertex) resolve(counts objCounts) (objVertexKey, error) {
+	key := objVertexKey{-1, -1, -1}
+	var err error
+	if key.position, err = resolveObjIndex(raw[0], counts.vertices); err != nil {
+		return key, err
+	}
+	if raw[1] != objMissingIndex {
+		if key.texCoord, err = resolveObjIndex(raw[1], counts.textureCoords); err != nil {
+			return key, err
+		}
+	}
+	if raw[2] != objMissingIndex {
+		if key.normal, err = resolveObjIndex(raw[2], counts.normals); err != nil {
+			return key, err
+		}
+	}
+	return key, nil
+}
+
+// resolveObjIndex converts a one based or negative relative .obj index into a zero based index
+func resolveObjIndex(i int64, count int) (int64, error) {
+	resolved := i - 1
+	if i < 0 {
+		resolved = i + int64(count)
+	}
+	if resolved < 0 || resolved >= int64(count) {
+		return 0, fmt.Errorf("Index %d out of range", i)
+	}
+	return resolved, nil
+}
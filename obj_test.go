@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const testOBJ = `mtllib test.mtl
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+vn 0 0 1
+o quad
+usemtl red
+f 1/1/1 2/2/1 3/3/1 4/4/1
+g back
+usemtl blue
+f 3 2 1
+l 1 2 3
+p 4
+`
+
+// testPosition returns the position of a vertex of the mesh
+func testPosition(mesh *Mesh, index uint32) mgl32.Vec3 {
+	return mgl32.Vec3{mesh.positions[3*index], mesh.positions[3*index+1], mesh.positions[3*index+2]}
+}
+
+func TestParseOBJTriangulation(t *testing.T) {
+	tests := []struct {
+		name      string
+		obj       string
+		triangles int
+		area      float32
+	}{
+		{"triangle", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n", 1, 0.5},
+		{"quad", "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nf 1 2 3 4\n", 2, 1},
+		// An L shape, which is not convex and can't be split into a fan
+		{"concave", "v 0 0 0\nv 2 0 0\nv 2 1 0\nv 1 1 0\nv 1 2 0\nv 0 2 0\nf 1 2 3 4 5 6\n", 4, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mesh, err := ParseOBJ(strings.NewReader(test.obj))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mesh.indices) != 3*test.triangles {
+				t.Fatalf("%d indices instead of %d", len(mesh.indices), 3*test.triangles)
+			}
+			// The triangles only cover the polygon exactly if they face the same way without overlaps or gaps
+			area := float32(0)
+			for i := 0; i+2 < len(mesh.indices); i += 3 {
+				a, b, c := testPosition(&mesh, mesh.indices[i]), testPosition(&mesh, mesh.indices[i+1]), testPosition(&mesh, mesh.indices[i+2])
+				triangleArea := b.Sub(a).Cross(c.Sub(a)).Z() / 2
+				if triangleArea <= 0 {
+					t.Fatalf("Triangle %d is flipped or degenerate", i/3)
+				}
+				area += triangleArea
+			}
+			if area != test.area {
+				t.Fatalf("Triangles have an area of %v instead of %v", area, test.area)
+			}
+		})
+	}
+}
+
+func TestParseOBJVertices(t *testing.T) {
+	obj := "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 1 1\nvt 0 1\nvn 0 0 1\n" +
+		// Both faces share two vertices with the same indices, the last one only differs in its texture coordinate
+		"f 1/1/1 2/2/1 3/3/1\nf 1/1/1 3/3/1 4/4/1\nf -4/-1/-1 -3/-3/-1 -2/-2/-1\n"
+	mesh, err := ParseOBJ(strings.NewReader(obj))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(mesh.indices, []uint32{0, 1, 2, 0, 2, 3, 4, 1, 2}) {
+		t.Fatalf("Indices %v", mesh.indices)
+	}
+	if len(mesh.positions) != 5*3 || len(mesh.textureCoords) != 5*2 || len(mesh.normals) != 5*3 {
+		t.Fatalf("%d positions, %d texture coordinates and %d normals", len(mesh.positions), len(mesh.textureCoords), len(mesh.normals))
+	}
+	// Texture coordinates are flipped vertically for OpenGL
+	if mesh.textureCoords[2*2+1] != 0 || mesh.textureCoords[4*2+1] != 0 || mesh.textureCoords[3*2+1] != 0 {
+		t.Fatalf("Texture coordinates %v", mesh.textureCoords)
+	}
+	if testPosition(&mesh, 4) != testPosition(&mesh, 0) {
+		t.Fatal("Negative index resolved to the wrong position")
+	}
+}
+
+func TestParseOBJInvalidIndices(t *testing.T) {
+	for _, face := range []string{"f 1 2 4", "f 1 2 0", "f 1 2 -4", "f 1/2 2 3", "f 1//2 2 3", "f 1 2", "f 1/1/1/1 2 3"} {
+		if _, err := ParseOBJ(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvn 0 0 1\n" + face + "\n")); err == nil {
+			t.Errorf("Expected an error for %q", face)
+		}
+	}
+}
+
+func TestParseOBJMaterialsAndParts(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"test.mtl": testMTL})
+	mesh, err := ParseOBJWithOptions(strings.NewReader(testOBJ), filepath.Join(dir, "test.obj"), ObjOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mesh.parts) != 2 || mesh.parts[0].name != "quad" || mesh.parts[1].name != "back" || mesh.parts[1].object != "quad" {
+		t.Fatalf("Parts %+v", mesh.parts)
+	}
+	quad, back := mesh.parts[0].submeshes, mesh.parts[1].submeshes
+	if len(quad) != 1 || quad[0].offset != 0 || quad[0].count != 6 || quad[0].material == nil || quad[0].material.name != "red" {
+		t.Fatalf("Submeshes of quad %+v", quad)
+	}
+	if quad[0].material.diffuse != (mgl32.Vec3{1, 0, 0}) || quad[0].material.dissolve != 0.5 {
+		t.Fatalf("Material %+v", quad[0].material)
+	}
+	if len(back) != 3 || back[0].offset != 6 || back[0].count != 3 || back[0].material.name != "blue" {
+		t.Fatalf("Submeshes of back %+v", back)
+	}
+	// Lines and points are drawn from the elements with the material of the faces before them
+	if back[1].mode != PrimitiveLines || back[1].count != 4 || back[2].mode != PrimitivePoints || back[2].count != 1 || back[1].material != back[0].material {
+		t.Fatalf("Elements of back %+v", back)
+	}
+	if len(mesh.materialLibraries) != 1 || filepath.Base(mesh.materialLibraries[0]) != "test.mtl" {
+		t.Fatalf("Material libraries %v", mesh.materialLibraries)
+	}
+}
+
+func TestParseOBJMissingMaterials(t *testing.T) {
+	// Without test.mtl, the library and both materials are reported, and the faces have no material
+	warnings := []*ParseError{}
+	options := ObjOptions{Warnings: func(warning *ParseError) { warnings = append(warnings, warning) }}
+	mesh, err := ParseOBJWithOptions(strings.NewReader(testOBJ), filepath.Join(t.TempDir(), "test.obj"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 3 || warnings[0].Line != 1 || warnings[1].Line != 12 || warnings[2].Line != 15 {
+		t.Fatalf("Warnings %v", warnings)
+	}
+	if len(mesh.indices) != 9 || mesh.parts[0].submeshes[0].material != nil {
+		t.Fatalf("Mesh %+v", mesh)
+	}
+}
+
+func TestParseOBJGeneratedNormals(t *testing.T) {
+	mesh, err := ParseOBJ(strings.NewReader("v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nf 1 2 3 4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(mesh.normals); i += 3 {
+		if mesh.normals[i] != 0 || mesh.normals[i+1] != 0 || mesh.normals[i+2] != 1 {
+			t.Fatalf("Normals %v", mesh.normals)
+		}
+	}
+}
+
+// testFaceVertex parses and resolves a face vertex after three elements of every kind were read
+func testFaceVertex(s string) (objVertexKey, error) {
+	raw, err := parseObjFaceVertex(s)
+	if err != nil {
+		return objVertexKey{}, err
+	}
+	return raw.resolve(objCounts{3, 3, 3})
+}
+
+func TestParseObjFaceVertex(t *testing.T) {
+	tests := []struct {
+		vertex string
+		key    objVertexKey
+	}{
+		{"1", objVertexKey{0, -1, -1}},
+		{"2/3", objVertexKey{1, 2, -1}},
+		{"3//1", objVertexKey{2, -1, 0}},
+		{"1/2/3", objVertexKey{0, 1, 2}},
+		// Negative indices count back from the last element read so far
+		{"-1/-1/-1", objVertexKey{2, 2, 2}},
+		{"-3/-2", objVertexKey{0, 1, -1}},
+	}
+	for _, test := range tests {
+		key, err := testFaceVertex(test.vertex)
+		if err != nil {
+			t.Fatalf("%s: %v", test.vertex, err)
+		}
+		if key != test.key {
+			t.Fatalf("%s: %+v instead of %+v", test.vertex, key, test.key)
+		}
+	}
+	for _, vertex := range []string{"0", "4", "-4", "1/4", "1//-4", "1/2/3/4", "x", "1/y", ""} {
+		if _, err := testFaceVertex(vertex); err == nil {
+			t.Errorf("Expected an error for %q", vertex)
+		}
+	}
+}
+
+const testInvalidOBJ = `v 0 0 0
+v 1 0 0
+v 0 1 0
+v 1 x 0
+f 1 2 4
+vn 0 1
+usemtl missing
+f 1 2 3
+`
+
+func TestOBJParseErrors(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"invalid.obj": testInvalidOBJ})
+	file := filepath.Join(dir, "invalid.obj")
+	_, err := CreateModelFromFile(file)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.File != file || parseErr.Line != 4 || parseErr.Column != 5 || parseErr.Token != "x" {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) {
+		t.Fatalf("Expected the error of the number in %v", err)
+	}
+	if err.Error() != file+`:4:5: Invalid number "x": strconv.ParseFloat: parsing "x": invalid syntax` {
+		t.Fatalf("Message %q", err.Error())
+	}
+
+	// The unknown material is only a warning
+	warnings := []*ParseError{}
+	options := ObjOptions{CollectErrors: true, Warnings: func(warning *ParseError) { warnings = append(warnings, warning) }}
+	_, err = CreateModelFromFileWithOptions(file, options)
+	errs, ok := err.(ParseErrors)
+	if !ok || len(errs) != 3 || len(warnings) != 1 || warnings[0].Line != 7 || warnings[0].Column != 8 {
+		t.Fatalf("Unexpected errors %v with warnings %v", err, warnings)
+	}
+	expected := [][2]int{{4, 5}, {5, 7}, {6, 0}}
+	for i, e := range errs {
+		if e.Line != expected[i][0] || e.Column != expected[i][1] {
+			t.Fatalf("Error %d at %d:%d instead of %d:%d", i, e.Line, e.Column, expected[i][0], expected[i][1])
+		}
+	}
+}
+
+func TestParseOBJStreaming(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"test.mtl": testMTL})
+	file := filepath.Join(dir, "test.obj")
+	expected, err := ParseOBJWithOptions(strings.NewReader(testOBJ), file, ObjOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		obj     string
+		options ObjOptions
+	}{
+		{"crlf", strings.ReplaceAll(testOBJ, "\n", "\r\n"), ObjOptions{}},
+		{"no final newline", strings.TrimSuffix(testOBJ, "\n"), ObjOptions{}},
+		{"size hint", testOBJ, ObjOptions{SizeHint: int64(len(testOBJ))}},
+		{"wrong size hint", testOBJ, ObjOptions{SizeHint: 1 << 20}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// A reader that returns a single byte at a time splits every line across reads
+			mesh, err := ParseOBJWithOptions(iotest.OneByteReader(strings.NewReader(test.obj)), file, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(mesh, expected) {
+				t.Fatalf("Mesh differs:\n%+v\n%+v", mesh, expected)
+			}
+		})
+	}
+
+	long := "v 0 0 0\n# " + strings.Repeat("x", objMaxLineLength) + "\n"
+	if _, err := ParseOBJ(strings.NewReader(long)); !errors.Is(err, bufio.ErrTooLong) {
+		t.Fatalf("Expected an error for a line that is too long, got %v", err)
+	}
+}
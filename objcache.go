@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// loadCachedOBJ loads an .obj file from the mesh cache in options.CacheDir. If the file is not cached or has changed,
+// it is parsed and written to the cache
+func loadCachedOBJ(file string, options ObjOptions) (Mesh, error) {
+	source, err := objCacheSource(file, options)
+	if err != nil {
+		return Mesh{}, err
+	}
+	cacheFile, err := objCachePath(file, options.CacheDir)
+	if err != nil {
+		return Mesh{}, err
+	}
+	if mesh, ok := readMeshCache(cacheFile, source); ok {
+		return mesh, nil
+	}
+
+	cacheDir := options.CacheDir
+	options.CacheDir = ""
+	// Meshes with warnings are not cached, since a missing material library can be added later
+	warnings := options.Warnings
+	warned := false
+	options.Warnings = func(warning *ParseError) {
+		warned = true
+		if warnings != nil {
+			warnings(warning)
+		} else {
+			log.Print("Warning: ", warning)
+		}
+	}
+	mesh, err := LoadOBJ(file, options)
+	if err != nil {
+		return Mesh{}, err
+	}
+	if !warned {
+		// A cache that can't be written only makes the next load slower, so errors are ignored
+		_ = writeMeshCache(cacheDir, cacheFile, &mesh, source)
+	}
+	return mesh, nil
+}
+
+// objCacheSource returns the hash of the .obj file combined with the options that change the parsed mesh,
+// so cached meshes are not used with other options
+func objCacheSource(file string, options ObjOptions) ([sha256.Size]byte, error) {
+	hash, err := hashFile(file)
+	if err != nil {
+		return hash, err
+	}
+	meshOptions := fmt.Sprintf("%+v", options.Normals)
+	if options.Optimize != nil {
+		meshOptions += fmt.Sprintf("%+v", *options.Optimize)
+	}
+	return sha256.Sum256(append(hash[:], meshOptions...)), nil
+}
+
+// objCachePath returns the path of the cached mesh of an .obj file. The name contains a hash of the absolute path,
+// so files with the same name in different directories don't overwrite each other
+func objCachePath(file string, cacheDir string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	pathHash := sha256.Sum256([]byte(abs))
+	return filepath.Join(cacheDir, filepath.Base(file)+"-"+hex.EncodeToString(pathHash[:8])+".mesh"), nil
+}
+
+// readMeshCache reads a cached mesh. It returns false if there is no valid cache for the source hash
+// or a material library has changed since the cache was written
+func readMeshCache(cacheFile string, source [sha256.Size]byte) (Mesh, bool) {
+	f, err := os.Open(cacheFile)
+	if err != nil {
+		return Mesh{}, false
+	}
+	defer f.Close()
+	mesh, header, err := decodeMesh(f)
+	if err != nil || header.source != source {
+		return Mesh{}, false
+	}
+	for _, l := range header.libraries {
+		if hash, err := hashFile(l.path); err != nil || hash != l.hash {
+			return Mesh{}, false
+		}
+		mesh.materialLibraries = append(mesh.materialLibraries, l.path)
+	}
+	return mesh, true
+}
+
+// writeMeshCache writes a mesh to the cache. The file is written to a temporary file first, so concurrent loads never see a partial file
+func writeMeshCache(cacheDir, cacheFile string, mesh *Mesh, source [sha256.Size]byte) error {
+	header := meshFileHeader{source: source}
+	for _, path := range mesh.materialLibraries {
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		header.libraries = append(header.libraries, meshFileLibrary{path, hash})
+	}
+
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(cacheDir, filepath.Base(cacheFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := encodeMesh(f, mesh, header); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), cacheFile)
+}
+
+// hashFile returns the SHA-256 hash of the content of a file
+func hashFile(file string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	f, err := os.Open(file)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
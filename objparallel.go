@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// The number of chunks per worker. More chunks than workers even out differences in parsing time between chunks
+const objChunksPerWorker = 4
+
+// objChunk holds a range of lines of an .obj file and the result of parsing it on its own
+type objChunk struct {
+	data  []byte
+	lines int
+	// Whether the chunk has a line that is too long for the sequential parser. The lines after it are not parsed
+	tooLong bool
+
+	// The parser holds the positions, texture coordinates and normals of the chunk
+	parser *objParser
+
+	rawVertices []objRawVertex
+	statements  []objStatement
+}
+
+// objStatement is a line of a chunk that depends on the lines before it and has to be applied in order when the chunks are merged
+type objStatement struct {
+	// The one based line number within the chunk and the range of the line in the chunk data
+	line       int
+	start, end int
+
+	// The number of elements the chunk contained up to the line
+	counts objCounts
+
+	// The range of the vertices of a parsed face in rawVertices. If count is 0, the line is parsed again while merging
+	first, count int
+}
+
+// parseOBJParallel parses .obj data by splitting it into chunks that are parsed concurrently. The chunks are merged in order,
+// which results in exactly the same mesh and errors as the sequential parser. Unlike the sequential parser, the whole input is read into memory
+func parseOBJParallel(r io.Reader, file string, options ObjOptions) (Mesh, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Mesh{}, err
+	}
+
+	chunks := splitOBJChunks(data, options.Workers*objChunksPerWorker)
+	work := make(chan *objChunk, len(chunks))
+	for _, c := range chunks {
+		work <- c
+	}
+	close(work)
+
+	var wg sync.WaitGroup
+	for i := 0; i < options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				c.parse(file)
+			}
+		}()
+	}
+	wg.Wait()
+
+	p := newObjParser(file)
+	p.normalOptions = options.Normals
+	p.optimizeOptions = options.Optimize
+	p.optimized = options.Optimized
+	p.warnings = options.Warnings
+	p.preallocate(len(data) / objBytesPerVertex)
+	errs := ParseErrors{}
+	lineOffset := 0
+	for _, c := range chunks {
+		if err := p.merge(c, lineOffset, options, &errs); err != nil {
+			return Mesh{}, err
+		}
+		lineOffset += c.lines
+	}
+	if len(errs) > 0 {
+		return Mesh{}, errs
+	}
+	return p.finish(), nil
+}
+
+// splitOBJChunks splits the data into about n chunks of similar size that end at line boundaries
+func splitOBJChunks(data []byte, n int) []*objChunk {
+	chunks := []*objChunk{}
+	size := len(data)/n + 1
+	for start := 0; start < len(data); {
+		end := start + size
+		if end >= len(data) {
+			end = len(data)
+		} else if i := bytes.IndexByte(data[end:], '\n'); i >= 0 {
+			end += i + 1
+		} else {
+			end = len(data)
+		}
+		chunks = append(chunks, &objChunk{data: data[start:end]})
+		start = end
+	}
+	return chunks
+}
+
+// parse parses all lines of the chunk that do not depend on previous lines and records the others as statements
+func (c *objChunk) parse(file string) {
+	c.parser = newObjParser(file)
+	p := c.parser
+	for start := 0; start < len(c.data); {
+		end := len(c.data)
+		next := end
+		if i := bytes.IndexByte(c.data[start:], '\n'); i >= 0 {
+			end = start + i
+			next = end + 1
+		}
+		// The sequential parser fails on lines that don't fit into the buffer of its scanner together with the line break
+		if end-start >= objMaxLineLength {
+			c.tooLong = true
+			break
+		}
+		// Like bufio.ScanLines, a single carriage return before the line break is dropped
+		if end > start && c.data[end-1] == '\r' {
+			end--
+		}
+		c.lines++
+		statement := objStatement{line: c.lines, start: start, end: end, counts: p.counts()}
+		start = next
+
+		p.fields, p.columns = splitFields(bytesToString(c.data[statement.start:statement.end]), p.fields[:0], p.columns[:0])
+		if len(p.fields) == 0 {
+			continue
+		}
+		switch p.fields[0] {
+		case "v", "vt", "vn":
+			// Invalid lines are parsed again while merging to create the error with the correct line number
+			if p.parseFields() != nil {
+				c.statements = append(c.statements, statement)
+			}
+		case "f":
+			statement.first = len(c.rawVertices)
+			if len(p.fields) >= 4 {
+				for _, s := range p.fields[1:] {
+					raw, err := parseObjFaceVertex(s)
+					if err != nil {
+						c.rawVertices = c.rawVertices[:statement.first]
+						break
+					}
+					c.rawVertices = append(c.rawVertices, raw)
+				}
+			}
+			statement.count = len(c.rawVertices) - statement.first
+			c.statements = append(c.statements, statement)
+		case "mtllib", "usemtl", "o", "g", "s", "l", "p":
+			c.statements = append(c.statements, statement)
+		}
+	}
+}
+
+// merge appends the elements of a parsed chunk and applies its statements in order
+func (p *objParser) merge(c *objChunk, lineOffset int, options ObjOptions, errs *ParseErrors) error {
+	prefix := p.counts()
+	p.vertices = append(p.vertices, c.parser.vertices...)
+	p.textureCoords = append(p.textureCoords, c.parser.textureCoords...)
+	p.normals = append(p.normals, c.parser.normals...)
+
+	for _, statement := range c.statements {
+		counts := objCounts{
+			vertices:      prefix.vertices + statement.counts.vertices,
+			textureCoords: prefix.textureCoords + statement.counts.textureCoords,
+			normals:       prefix.normals + statement.counts.normals,
+		}
+		if statement.count > 0 && p.addRawFace(c.rawVertices[statement.first:statement.first+statement.count], counts) {
+			continue
+		}
+
+		p.line = lineOffset + statement.line
+		p.fields, p.columns = splitFields(bytesToString(c.data[statement.start:statement.end]), p.fields[:0], p.columns[:0])
+		var err error
+		switch p.fields[0] {
+		case "f":
+			err = p.parseFace(counts)
+		case "l", "p":
+			err = p.parseElement(counts)
+		default:
+			err = p.parseFields()
+		}
+		if err := collectParseError(err, options, errs); err != nil {
+			return err
+		}
+	}
+	if c.tooLong {
+		return bufio.ErrTooLong
+	}
+	return nil
+}
+
+// addRawFace resolves the indices of a face and adds it. It returns false if an index is out of range
+func (p *objParser) addRawFace(raws []objRawVertex, counts objCounts) bool {
+	faceVertices := p.faceVertices[:0]
+	for _, raw := range raws {
+		key, err := raw.resolve(counts)
+		if err != nil {
+			return false
+		}
+		faceVertices = append(faceVertices, key)
+	}
+	p.faceVertices = faceVertices
+	p.addFace(faceVertices)
+	return true
+}
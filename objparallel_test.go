@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testGridOBJ returns an .obj file with a grid of n x n quads that switches groups and materials every row.
+// Faces use negative indices, which are resolved relative to the vertices of the previous rows
+func testGridOBJ(n int) string {
+	var b strings.Builder
+	b.WriteString("mtllib test.mtl\n")
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			fmt.Fprintf(&b, "v %d %d 0\nvt %g %g\n", x, y, float32(x)/float32(n), float32(y)/float32(n))
+		}
+	}
+	b.WriteString("vn 0 0 1\n")
+	row := n + 1
+	for y := 0; y < n; y++ {
+		material := "red"
+		if y%2 == 1 {
+			material = "blue"
+		}
+		fmt.Fprintf(&b, "g row%d\nusemtl %s\ns %d\n", y, material, y%3)
+		for x := 0; x < n; x++ {
+			// Relative to the end of the vertices
+			a := (y*row + x) - (row * (n + 1))
+			fmt.Fprintf(&b, "f %d/%d/-1 %d/%d/-1 %d/%d/-1 %d/%d/-1\n", a, a, a+1, a+1, a+row+1, a+row+1, a+row, a+row)
+		}
+	}
+	return b.String()
+}
+
+func TestParseOBJParallel(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  string
+	}{
+		{"grid", testGridOBJ(8)},
+		{"crlf", strings.ReplaceAll(testGridOBJ(4), "\n", "\r\n")},
+		{"no final newline", strings.TrimSuffix(testGridOBJ(3), "\n")},
+		{"vertices after faces", "v 0 0 0\nv 1 0 0\nv 1 1 0\nf -3 -2 -1\no next\nv 0 1 0\nf -4 -2 -1\nf 1 2 4\n"},
+		{"objects and elements", testOBJ},
+		{"errors", "v 0 0 0\nv 1 0 0\nv x 1 0\nv 1 1 0\nf 1 2 3\nf 1 2 9\nf 1 -9 2\nvt 1\nf 1/a 2 3\nf 1 2\nl 1\np 7\nusemtl nope\nf 3 2 1\n"},
+		{"crlf errors", "v 0 0 0\r\nv 1 0 0\r\nv 1 1 0\r\nf 1 2 4\r\nf 1 2 3\r\nf 1 2\r\n"},
+		{"longest line", "v 0 0 0\nv 1 0 0\nv 0 1 0\n# " + strings.Repeat("x", objMaxLineLength-3) + "\nf 1 2 3\n"},
+		{"line too long", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n# " + strings.Repeat("x", objMaxLineLength-2) + "\nf 3 2 1\n"},
+		{"error before a line too long", "v x 0 0\n# " + strings.Repeat("x", objMaxLineLength) + "\nf 1 2 3\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeTestFiles(t, map[string]string{"test.mtl": testMTL})
+			file := filepath.Join(dir, "test.obj")
+			for _, collect := range []bool{false, true} {
+				options := ObjOptions{CollectErrors: collect, Warnings: func(*ParseError) {}}
+				expected, expectedErr := ParseOBJWithOptions(strings.NewReader(test.obj), file, options)
+				if expectedErr == nil && len(expected.indices) == 0 {
+					t.Fatal("Sequential parser read no faces")
+				}
+				// Many workers split the small input into chunks of a few lines
+				for _, workers := range []int{2, 3, 8, 32} {
+					options.Workers = workers
+					mesh, err := parseOBJParallel(strings.NewReader(test.obj), file, options)
+					if fmt.Sprint(err) != fmt.Sprint(expectedErr) {
+						t.Fatalf("%d workers, collect %v: error\n%v\ninstead of\n%v", workers, collect, err, expectedErr)
+					}
+					if !reflect.DeepEqual(mesh, expected) {
+						t.Fatalf("%d workers, collect %v: mesh differs", workers, collect)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseOBJParallelErrorLines(t *testing.T) {
+	obj := strings.Repeat("v 0 0 0\n", 100) + "v 0 x 0\n" + strings.Repeat("v 1 1 1\n", 100) + "f 1 2 999\n"
+	_, err := parseOBJParallel(strings.NewReader(obj), "test.obj", ObjOptions{Workers: 8, CollectErrors: true})
+	errs, ok := err.(ParseErrors)
+	if !ok || len(errs) != 2 || errs[0].Line != 101 || errs[0].Column != 5 || errs[1].Line != 202 || errs[1].Column != 7 {
+		t.Fatalf("Unexpected errors %v", err)
+	}
+}
+
+func BenchmarkParseOBJParallel(b *testing.B) {
+	data := []byte(testGridOBJ(300))
+	dir := b.TempDir()
+	file := filepath.Join(dir, "test.obj")
+	options := ObjOptions{Warnings: func(*ParseError) {}}
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("%d workers", workers), func(b *testing.B) {
+			options.Workers = workers
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := ParseOBJWithOptions(bytes.NewReader(data), file, options); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SaveOBJ writes the mesh to an .obj file. If the mesh has materials, they are written to an .mtl file with the same base name
+// next to it. Texture paths are made relative to the output directory and embedded textures are written to their own files
+func SaveOBJ(file string, mesh *Mesh) error {
+	materials := meshMaterials(mesh)
+	library := ""
+	if len(materials) > 0 {
+		library = strings.TrimSuffix(file, filepath.Ext(file)) + ".mtl"
+		if err := saveMTL(library, materials); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := WriteOBJ(f, mesh, filepath.Base(library)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteOBJ writes the mesh in the .obj format. If library is not empty, it is referenced with mtllib and the submeshes use their materials.
+// Texture coordinates are flipped back, so the result loads into the same mesh again. Line and point submeshes are written as
+// l and p elements, other primitive modes are skipped
+func WriteOBJ(w io.Writer, mesh *Mesh, library string) error {
+	bw := bufio.NewWriter(w)
+	if library != "" {
+		fmt.Fprintf(bw, "mtllib %s\n", library)
+	}
+
+	for i := 0; i+2 < len(mesh.positions); i += 3 {
+		fmt.Fprintf(bw, "v %s %s %s\n", formatFloat(mesh.positions[i]), formatFloat(mesh.positions[i+1]), formatFloat(mesh.positions[i+2]))
+	}
+	for i := 0; i+1 < len(mesh.textureCoords); i += 2 {
+		fmt.Fprintf(bw, "vt %s %s\n", formatFloat(mesh.textureCoords[i]), formatFloat(1-mesh.textureCoords[i+1]))
+	}
+	for i := 0; i+2 < len(mesh.normals); i += 3 {
+		fmt.Fprintf(bw, "vn %s %s %s\n", formatFloat(mesh.normals[i]), formatFloat(mesh.normals[i+1]), formatFloat(mesh.normals[i+2]))
+	}
+
+	// Every vertex has a position, texture coordinate and normal with the same index
+	hasTextureCoords := len(mesh.textureCoords) > 0
+	hasNormals := len(mesh.normals) > 0
+	// Lines only have texture coordinates and points only positions
+	writeElements := func(keyword string, indices []uint32, size int, normals, textureCoords bool) {
+		for i := 0; i+size <= len(indices); i += size {
+			bw.WriteString(keyword)
+			for _, index := range indices[i : i+size] {
+				n := strconv.FormatUint(uint64(index)+1, 10)
+				switch {
+				case textureCoords && normals:
+					fmt.Fprintf(bw, " %s/%s/%s", n, n, n)
+				case normals:
+					fmt.Fprintf(bw, " %s//%s", n, n)
+				case textureCoords:
+					fmt.Fprintf(bw, " %s/%s", n, n)
+				default:
+					fmt.Fprintf(bw, " %s", n)
+				}
+			}
+			bw.WriteString("\n")
+		}
+	}
+	writeFaces := func(indices []uint32) {
+		writeElements("f", indices, 3, hasNormals, hasTextureCoords)
+	}
+	writeSubmesh := func(s Submesh) {
+		switch s.mode {
+		case PrimitiveLines:
+			writeElements("l", mesh.elementIndices[s.offset:s.offset+s.count], 2, false, hasTextureCoords)
+		case PrimitivePoints:
+			writeElements("p", mesh.elementIndices[s.offset:s.offset+s.count], 1, false, false)
+		case PrimitiveTriangles:
+			writeFaces(mesh.indices[s.offset : s.offset+s.count])
+		}
+	}
+
+	if len(mesh.parts) == 0 {
+		writeFaces(mesh.indices)
+		return bw.Flush()
+	}
+
+	names := materialNames(meshMaterials(mesh))
+	object := ""
+	var material *Material
+	for i, p := range mesh.parts {
+		// A new object starts a part named after it, which is replaced by the group if it has another name
+		if p.object != object {
+			fmt.Fprintf(bw, "o %s\n", p.object)
+			object = p.object
+			if p.name != p.object {
+				fmt.Fprintf(bw, "g %s\n", p.name)
+			}
+		} else if i > 0 || p.name != "" {
+			fmt.Fprintf(bw, "g %s\n", p.name)
+		}
+		for _, s := range p.submeshes {
+			// Materials can't be reset in .obj files, so submeshes without a material keep the previous one
+			if library != "" && s.material != nil && s.material != material {
+				fmt.Fprintf(bw, "usemtl %s\n", names[s.material])
+				material = s.material
+			}
+			writeSubmesh(s)
+		}
+	}
+	return bw.Flush()
+}
+
+// saveMTL writes the materials to an .mtl file
+func saveMTL(file string, materials []*Material) error {
+	dir := filepath.Dir(file)
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	names := materialNames(materials)
+
+	// Maps are referenced relative to the library. Embedded images are written next to it
+	maps := map[string]string{}
+	for _, m := range materials {
+		for _, name := range []string{m.diffuseMap, m.bumpMap, m.specularMap} {
+			if _, ok := maps[name]; ok || name == "" {
+				continue
+			}
+			data, embedded := m.mapData[name]
+			if !embedded {
+				maps[name] = relativePath(dir, name)
+				continue
+			}
+			imageFile := fmt.Sprintf("%s_%d%s", base, len(maps), imageExtension(data))
+			if err := ioutil.WriteFile(filepath.Join(dir, imageFile), data, 0644); err != nil {
+				return err
+			}
+			maps[name] = imageFile
+		}
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := WriteMTL(f, materials, names, maps); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteMTL writes the materials in the .mtl format. The names and the paths of the maps can be replaced, e.g. to make
+// names unique or paths relative. Materials and maps that are missing from the replacements are written unchanged
+func WriteMTL(w io.Writer, materials []*Material, names map[*Material]string, maps map[string]string) error {
+	bw := bufio.NewWriter(w)
+	formatColor := func(c [3]float32) string {
+		return formatFloat(c[0]) + " " + formatFloat(c[1]) + " " + formatFloat(c[2])
+	}
+	for i, m := range materials {
+		name, ok := names[m]
+		if !ok {
+			name = m.name
+		}
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		fmt.Fprintf(bw, "newmtl %s\n", name)
+		fmt.Fprintf(bw, "Ka %s\n", formatColor(m.ambient))
+		fmt.Fprintf(bw, "Kd %s\n", formatColor(m.diffuse))
+		fmt.Fprintf(bw, "Ks %s\n", formatColor(m.specular))
+		fmt.Fprintf(bw, "Ns %s\n", formatFloat(m.shininess))
+		fmt.Fprintf(bw, "d %s\n", formatFloat(m.dissolve))
+		fmt.Fprintf(bw, "illum %d\n", m.illum)
+		for _, textureMap := range []struct{ keyword, path string }{{"map_Kd", m.diffuseMap}, {"map_Bump", m.bumpMap}, {"map_Ks", m.specularMap}} {
+			if textureMap.path == "" {
+				continue
+			}
+			path, ok := maps[textureMap.path]
+			if !ok {
+				path = textureMap.path
+			}
+			fmt.Fprintf(bw, "%s %s\n", textureMap.keyword, filepath.ToSlash(path))
+		}
+	}
+	return bw.Flush()
+}
+
+// meshMaterials returns the materials of all submeshes of the mesh in order of their first use
+func meshMaterials(mesh *Mesh) []*Material {
+	materials := []*Material{}
+	seen := map[*Material]bool{}
+	for _, p := range mesh.parts {
+		for _, s := range p.submeshes {
+			if s.material != nil && !seen[s.material] {
+				seen[s.material] = true
+				materials = append(materials, s.material)
+			}
+		}
+	}
+	return materials
+}
+
+// materialNames assigns a unique, non-empty name without whitespace to every material
+func materialNames(materials []*Material) map[*Material]string {
+	names := map[*Material]string{}
+	used := map[string]bool{}
+	for i, m := range materials {
+		name := strings.Join(strings.Fields(m.name), "_")
+		if name == "" {
+			name = fmt.Sprintf("material%d", i)
+		}
+		for unique, n := name, 2; ; n++ {
+			if !used[unique] {
+				name = unique
+				break
+			}
+			unique = fmt.Sprintf("%s_%d", name, n)
+		}
+		used[name] = true
+		names[m] = name
+	}
+	return names
+}
+
+// relativePath returns the path relative to dir if possible and the unchanged path otherwise
+func relativePath(dir, path string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return path
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(absDir, absPath); err == nil {
+		return rel
+	}
+	return path
+}
+
+// imageExtension returns the file extension for the format of the image data
+func imageExtension(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/bmp":
+		return ".bmp"
+	}
+	return ".img"
+}
+
+// formatFloat formats a float with the shortest representation that reads back as the same value
+func formatFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'g', -1, 32)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveOBJRoundTrip(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"test.obj": testOBJ, "test.mtl": testMTL})
+	mesh, err := LoadOBJ(filepath.Join(dir, "test.obj"), ObjOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "saved.obj")
+	if err := SaveOBJ(file, &mesh); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := LoadOBJ(file, ObjOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(mesh.positions, saved.positions) || !reflect.DeepEqual(mesh.normals, saved.normals) ||
+		!reflect.DeepEqual(mesh.textureCoords, saved.textureCoords) || !reflect.DeepEqual(mesh.indices, saved.indices) ||
+		!reflect.DeepEqual(mesh.elementIndices, saved.elementIndices) {
+		t.Fatalf("Saved mesh differs:\n%+v\n%+v", mesh, saved)
+	}
+	if len(saved.materialLibraries) != 1 || filepath.Base(saved.materialLibraries[0]) != "saved.mtl" {
+		t.Fatalf("Material libraries %v", saved.materialLibraries)
+	}
+	if len(mesh.parts) != len(saved.parts) {
+		t.Fatalf("Parts %+v", saved.parts)
+	}
+	for i, p := range mesh.parts {
+		q := saved.parts[i]
+		if p.name != q.name || p.object != q.object || len(p.submeshes) != len(q.submeshes) {
+			t.Fatalf("Part %+v instead of %+v", q, p)
+		}
+		for j, s := range p.submeshes {
+			r := q.submeshes[j]
+			if s.offset != r.offset || s.count != r.count || s.mode != r.mode || s.material.name != r.material.name ||
+				s.material.diffuse != r.material.diffuse || s.material.dissolve != r.material.dissolve {
+				t.Fatalf("Submesh %+v instead of %+v", r, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// OptimizeOptions configures the reordering of the triangles and vertices of a mesh for faster rendering
+type OptimizeOptions struct {
+	// CacheSize is the number of vertices in the simulated post-transform cache. 0 uses 16
+	CacheSize int
+	// Overdraw sorts clusters of triangles so triangles facing outwards are drawn first and hide the ones behind them
+	Overdraw bool
+	// OverdrawThreshold is the factor by which the sort for overdraw may make the ACMR worse. Values below 1 use 1.05
+	OverdrawThreshold float32
+	// VertexFetch reorders the vertices in the order they are used by the triangles, so the vertex fetches are mostly sequential
+	VertexFetch bool
+}
+
+// OptimizeStats reports the efficiency of the post-transform cache before and after an optimization. The ACMR is the average
+// number of vertices transformed per triangle, which is 0.5 at best for large meshes and 3 at worst. The ATVR is the average
+// number of times every vertex is transformed, which is 1 at best
+type OptimizeStats struct {
+	ACMRBefore float32
+	ACMRAfter  float32
+	ATVRBefore float32
+	ATVRAfter  float32
+}
+
+func (s OptimizeStats) String() string {
+	return fmt.Sprintf("ACMR %.3f -> %.3f, ATVR %.3f -> %.3f", s.ACMRBefore, s.ACMRAfter, s.ATVRBefore, s.ATVRAfter)
+}
+
+// The default size of the simulated cache and the default overdraw threshold
+const (
+	optimizeDefaultCacheSize = 16
+	optimizeDefaultThreshold = 1.05
+)
+
+// Optimize reorders the triangles of every submesh and level of detail for the post-transform cache with Tom Forsyth's algorithm,
+// optionally sorts them for less overdraw and reorders the vertices for the vertex fetch. The submeshes keep their ranges
+// of the index buffer, so materials and parts are unchanged. It returns the cache efficiency of the full mesh
+func (m *Mesh) Optimize(options OptimizeOptions) OptimizeStats {
+	if options.CacheSize <= 3 {
+		options.CacheSize = optimizeDefaultCacheSize
+	}
+	if options.OverdrawThreshold < 1 {
+		options.OverdrawThreshold = optimizeDefaultThreshold
+	}
+	vertexCount := len(m.positions) / 3
+	stats := OptimizeStats{}
+	stats.ACMRBefore, stats.ATVRBefore = CacheEfficiency(m.indices, vertexCount, options.CacheSize)
+
+	// Indices of the vertices in the ranges, which is reset after every range
+	local := make([]int32, vertexCount)
+	for i := range local {
+		local[i] = -1
+	}
+	optimizeRanges := func(indices []uint32, parts []ModelPart) {
+		ranges := [][]uint32{indices}
+		if len(parts) > 0 {
+			ranges = ranges[:0]
+			for _, p := range parts {
+				for _, s := range p.submeshes {
+					if s.mode == PrimitiveTriangles {
+						ranges = append(ranges, indices[s.offset:s.offset+s.count])
+					}
+				}
+			}
+		}
+		for _, r := range ranges {
+			optimizeVertexCache(r, local, options.CacheSize)
+			if options.Overdraw {
+				optimizeOverdraw(r, m, options.CacheSize, options.OverdrawThreshold)
+			}
+		}
+	}
+	optimizeRanges(m.indices, m.parts)
+	for _, lod := range m.lods {
+		optimizeRanges(lod.indices, lod.parts)
+	}
+	if options.VertexFetch {
+		m.optimizeVertexFetch()
+	}
+
+	stats.ACMRAfter, stats.ATVRAfter = CacheEfficiency(m.indices, vertexCount, options.CacheSize)
+	return stats
+}
+
+// CacheEfficiency simulates a FIFO post-transform cache of the given size and returns the ACMR and ATVR of the triangle indices
+func CacheEfficiency(indices []uint32, vertexCount, cacheSize int) (acmr, atvr float32) {
+	if len(indices) < 3 {
+		return 0, 0
+	}
+	// The time every vertex entered the cache. Vertices are in the cache if they entered it less than cacheSize misses ago
+	entered := make([]int, vertexCount)
+	used := make([]bool, vertexCount)
+	misses := 0
+	unique := 0
+	for _, v := range indices {
+		if !used[v] {
+			used[v] = true
+			unique++
+		} else if misses-entered[v] < cacheSize {
+			continue
+		}
+		misses++
+		entered[v] = misses
+	}
+	return float32(misses) / float32(len(indices)/3), float32(misses) / float32(unique)
+}
+
+// The parameters of the vertex scores of Forsyth's algorithm
+const (
+	forsythCacheDecayPower   = 1.5
+	forsythLastTriangleScore = 0.75
+	forsythValenceBoostScale = 2.0
+	forsythValencePower      = 0.5
+)
+
+// forsythScore returns the score of a vertex at the position in the LRU cache, which is -1 outside of it,
+// with the given number of triangles that still use it
+func forsythScore(cachePosition, remaining, cacheSize int) float32 {
+	if remaining == 0 {
+		return -1
+	}
+	score := float32(0)
+	switch {
+	case cachePosition < 0:
+	case cachePosition < 3:
+		// The vertices of the last triangle have a fixed score, so it is not reused at once
+		score = forsythLastTriangleScore
+	default:
+		score = float32(math.Pow(1-float64(cachePosition-3)/float64(cacheSize-3), forsythCacheDecayPower))
+	}
+	// Vertices with few remaining triangles are preferred, so they don't end up as lone triangles later
+	return score + forsythValenceBoostScale*float32(math.Pow(float64(remaining), -forsythValencePower))
+}
+
+// optimizeVertexCache reorders the triangles in place with Tom Forsyth's linear-speed vertex cache optimization.
+// local must have an entry of -1 for every vertex and is restored before returning
+func optimizeVertexCache(indices []uint32, local []int32, cacheSize int) {
+	triangleCount := len(indices) / 3
+	if triangleCount < 2 {
+		return
+	}
+	vertices := []uint32{}
+	triangles := make([][3]int32, triangleCount)
+	for i, v := range indices[:triangleCount*3] {
+		if local[v] < 0 {
+			local[v] = int32(len(vertices))
+			vertices = append(vertices, v)
+		}
+		triangles[i/3][i%3] = local[v]
+	}
+	for _, v := range vertices {
+		local[v] = -1
+	}
+
+	// The triangles of every vertex that are not drawn yet, stored in one list with a range per vertex
+	vertexCount := len(vertices)
+	remaining := make([]int, vertexCount)
+	for _, t := range triangles {
+		for _, v := range t {
+			remaining[v]++
+		}
+	}
+	first := make([]int, vertexCount+1)
+	for v := 0; v < vertexCount; v++ {
+		first[v+1] = first[v] + remaining[v]
+	}
+	adjacency := make([]int32, first[vertexCount])
+	fill := append([]int{}, first[:vertexCount]...)
+	for t, triangle := range triangles {
+		for _, v := range triangle {
+			adjacency[fill[v]] = int32(t)
+			fill[v]++
+		}
+	}
+
+	cachePosition := make([]int, vertexCount)
+	scores := make([]float32, vertexCount)
+	for v := range scores {
+		cachePosition[v] = -1
+		scores[v] = forsythScore(-1, remaining[v], cacheSize)
+	}
+
+	added := make([]bool, triangleCount)
+	cache := make([]int32, 0, cacheSize+3)
+	newCache := make([]int32, 0, cacheSize+3)
+	result := make([]uint32, 0, triangleCount*3)
+	best := -1
+	next := 0
+	for len(result) < triangleCount*3 {
+		if best < 0 {
+			// No triangle in the cache is left, so the next one in the input order starts over
+			for added[next] {
+				next++
+			}
+			best = next
+		}
+		triangle := triangles[best]
+		added[best] = true
+		for _, v := range triangle {
+			result = append(result, vertices[v])
+			// Remove the triangle from the remaining triangles of the vertex
+			list := adjacency[first[v] : first[v]+remaining[v]]
+			for i, t := range list {
+				if int(t) == best {
+					list[i] = list[len(list)-1]
+					break
+				}
+			}
+			remaining[v]--
+		}
+
+		// The vertices of the triangle move to the front of the LRU cache
+		newCache = append(newCache[:0], triangle[:]...)
+		for _, v := range cache {
+			if v != triangle[0] && v != triangle[1] && v != triangle[2] {
+				newCache = append(newCache, v)
+			}
+		}
+		cache, newCache = newCache, cache
+		for i, v := range cache {
+			if i >= cacheSize {
+				cachePosition[v] = -1
+			} else {
+				cachePosition[v] = i
+			}
+			scores[v] = forsythScore(cachePosition[v], remaining[v], cacheSize)
+		}
+
+		// Only the scores of triangles with vertices in the cache change, and the best of them is drawn next
+		best = -1
+		bestScore := float32(-1)
+		for _, v := range cache {
+			for _, t := range adjacency[first[v] : first[v]+remaining[v]] {
+				triangle := triangles[t]
+				if score := scores[triangle[0]] + scores[triangle[1]] + scores[triangle[2]]; score > bestScore {
+					best, bestScore = int(t), score
+				}
+			}
+		}
+		if len(cache) > cacheSize {
+			cache = cache[:cacheSize]
+		}
+	}
+	copy(indices, result)
+}
+
+// optimizeOverdraw splits the triangles ordered for the vertex cache into clusters and sorts the clusters, so the ones
+// facing away from the center of the mesh are drawn first. Clusters end where the cache is cold or the ACMR of the cluster
+// is below the threshold times the ACMR of the range, so the sort costs little cache efficiency
+func optimizeOverdraw(indices []uint32, m *Mesh, cacheSize int, threshold float32) {
+	triangleCount := len(indices) / 3
+	if triangleCount < 2 {
+		return
+	}
+	vertexCount := len(m.positions) / 3
+	acmr, _ := CacheEfficiency(indices, vertexCount, cacheSize)
+
+	// Triangles whose vertices all miss the cache start a new cluster anyway
+	entered := map[uint32]int{}
+	misses := 0
+	hard := make([]bool, triangleCount)
+	for t := 0; t < triangleCount; t++ {
+		triangleMisses := 0
+		for _, v := range indices[3*t : 3*t+3] {
+			if e, ok := entered[v]; !ok || misses-e >= cacheSize {
+				misses++
+				triangleMisses++
+				entered[v] = misses
+			}
+		}
+		hard[t] = triangleMisses == 3
+	}
+
+	// Clusters start with a cold cache, because any other cluster may be drawn before them. A cluster also ends
+	// as soon as its ACMR is low enough
+	entered = map[uint32]int{}
+	misses = 0
+	clusters := []int{0}
+	start, startMisses := 0, 0
+	for t := 0; t < triangleCount; t++ {
+		for _, v := range indices[3*t : 3*t+3] {
+			if e, ok := entered[v]; !ok || e <= startMisses || misses-e >= cacheSize {
+				misses++
+				entered[v] = misses
+			}
+		}
+		if t+1 == triangleCount {
+			break
+		}
+		if hard[t+1] || float32(misses-startMisses) <= threshold*acmr*float32(t+1-start) {
+			clusters = append(clusters, t+1)
+			start, startMisses = t+1, misses
+		}
+	}
+	if len(clusters) < 2 {
+		return
+	}
+	clusters = append(clusters, triangleCount)
+
+	// The center of the range weighted by the area of the triangles
+	center := mgl32.Vec3{}
+	totalArea := float32(0)
+	for t := 0; t < triangleCount; t++ {
+		p0, p1, p2 := m.position(indices[3*t]), m.position(indices[3*t+1]), m.position(indices[3*t+2])
+		area := p1.Sub(p0).Cross(p2.Sub(p0)).Len()
+		center = center.Add(p0.Add(p1).Add(p2).Mul(area / 3))
+		totalArea += area
+	}
+	if totalArea > 0 {
+		center = center.Mul(1 / totalArea)
+	}
+
+	type cluster struct {
+		first, end int
+		key        float32
+	}
+	sorted := make([]cluster, len(clusters)-1)
+	for i := range sorted {
+		c := cluster{first: clusters[i], end: clusters[i+1]}
+		normal := mgl32.Vec3{}
+		centroid := mgl32.Vec3{}
+		area := float32(0)
+		for t := c.first; t < c.end; t++ {
+			p0, p1, p2 := m.position(indices[3*t]), m.position(indices[3*t+1]), m.position(indices[3*t+2])
+			n := p1.Sub(p0).Cross(p2.Sub(p0))
+			normal = normal.Add(n)
+			centroid = centroid.Add(p0.Add(p1).Add(p2).Mul(n.Len() / 3))
+			area += n.Len()
+		}
+		if area > 0 {
+			centroid = centroid.Mul(1 / area)
+		}
+		if l := normal.Len(); l > 0 {
+			normal = normal.Mul(1 / l)
+		}
+		c.key = centroid.Sub(center).Dot(normal)
+		sorted[i] = c
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].key > sorted[j].key })
+
+	result := make([]uint32, 0, triangleCount*3)
+	for _, c := range sorted {
+		result = append(result, indices[3*c.first:3*c.end]...)
+	}
+	// The sort is dropped if it costs more cache efficiency than allowed, which can happen for ranges with few clusters
+	if sortedACMR, _ := CacheEfficiency(result, vertexCount, cacheSize); sortedACMR <= acmr*threshold {
+		copy(indices, result)
+	}
+}
+
+// optimizeVertexFetch reorders the vertices in the order of their first use by the triangles, elements and levels of detail of the mesh.
+// Unused vertices are moved to the end
+func (m *Mesh) optimizeVertexFetch() {
+	vertexCount := len(m.positions) / 3
+	remap := make([]int32, vertexCount)
+	for i := range remap {
+		remap[i] = -1
+	}
+	order := make([]uint32, 0, vertexCount)
+	use := func(indices []uint32) {
+		for _, v := range indices {
+			if remap[v] < 0 {
+				remap[v] = int32(len(order))
+				order = append(order, v)
+			}
+		}
+	}
+	use(m.indices)
+	use(m.elementIndices)
+	for _, lod := range m.lods {
+		use(lod.indices)
+	}
+	for v := range remap {
+		if remap[v] < 0 {
+			remap[v] = int32(len(order))
+			order = append(order, uint32(v))
+		}
+	}
+
+	for _, attribute := range meshFileAttributes(m) {
+		data := *attribute.data
+		n := int(attribute.components)
+		if len(data) != vertexCount*n {
+			continue
+		}
+		reordered := make([]float32, len(data))
+		for i, v := range order {
+			copy(reordered[i*n:(i+1)*n], data[int(v)*n:(int(v)+1)*n])
+		}
+		*attribute.data = reordered
+	}
+	for i, v := range m.indices {
+		m.indices[i] = uint32(remap[v])
+	}
+	for i, v := range m.elementIndices {
+		m.elementIndices[i] = uint32(remap[v])
+	}
+	for _, lod := range m.lods {
+		for i, v := range lod.indices {
+			lod.indices[i] = uint32(remap[v])
+		}
+	}
+}
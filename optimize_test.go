@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// testCorner returns the attributes of a vertex as a string, so corners can be compared after vertices are reordered
+func testCorner(m *Mesh, v uint32) string {
+	s := fmt.Sprint(m.positions[3*v : 3*v+3])
+	if len(m.normals) > 0 {
+		s += fmt.Sprint(m.normals[3*v : 3*v+3])
+	}
+	if len(m.textureCoords) > 0 {
+		s += fmt.Sprint(m.textureCoords[2*v : 2*v+2])
+	}
+	if len(m.colors) > 0 {
+		s += fmt.Sprint(m.colors[4*v : 4*v+4])
+	}
+	return s
+}
+
+// testTriangleSet returns the sorted triangles of the indices. Every triangle starts with its smallest corner, which keeps its winding
+func testTriangleSet(m *Mesh, indices []uint32) []string {
+	triangles := make([]string, 0, len(indices)/3)
+	for i := 0; i < len(indices); i += 3 {
+		corners := []string{testCorner(m, indices[i]), testCorner(m, indices[i+1]), testCorner(m, indices[i+2])}
+		first := 0
+		for c := 1; c < 3; c++ {
+			if corners[c] < corners[first] {
+				first = c
+			}
+		}
+		triangles = append(triangles, corners[first]+corners[(first+1)%3]+corners[(first+2)%3])
+	}
+	sort.Strings(triangles)
+	return triangles
+}
+
+// testSameTriangles checks if two sets of triangles from testTriangleSet are equal
+func testSameTriangles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// testShuffleTriangles shuffles the triangles of every submesh of the mesh within the range of the submesh
+func testShuffleTriangles(m *Mesh, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	for _, s := range m.parts[0].submeshes {
+		indices := m.indices[s.offset : s.offset+s.count]
+		r.Shuffle(len(indices)/3, func(i, j int) {
+			for c := 0; c < 3; c++ {
+				indices[3*i+c], indices[3*j+c] = indices[3*j+c], indices[3*i+c]
+			}
+		})
+	}
+}
+
+// testBoxMesh returns a closed box between the origin and size, whose faces are grids of n x n quads facing outwards
+func testBoxMesh(n int, size mgl32.Vec3) Mesh {
+	m := Mesh{}
+	for axis := 0; axis < 3; axis++ {
+		u, v := (axis+1)%3, (axis+2)%3
+		for side := 0; side < 2; side++ {
+			first := uint32(len(m.positions) / 3)
+			for y := 0; y <= n; y++ {
+				for x := 0; x <= n; x++ {
+					p := mgl32.Vec3{}
+					p[axis] = float32(side) * size[axis]
+					p[u] = float32(x) / float32(n) * size[u]
+					p[v] = float32(y) / float32(n) * size[v]
+					m.positions = append(m.positions, p[0], p[1], p[2])
+				}
+			}
+			for y := 0; y < n; y++ {
+				for x := 0; x < n; x++ {
+					a := first + uint32(y*(n+1)+x)
+					b, c, d := a+1, a+uint32(n+2), a+uint32(n+1)
+					if side == 1 {
+						m.indices = append(m.indices, a, b, c, a, c, d)
+					} else {
+						m.indices = append(m.indices, a, c, b, a, d, c)
+					}
+				}
+			}
+		}
+	}
+	return m
+}
+
+func TestOptimizeVertexCache(t *testing.T) {
+	for _, options := range []OptimizeOptions{{}, {Overdraw: true}} {
+		m := testSeamGrid(30)
+		testShuffleTriangles(&m, 1)
+		submeshes := m.parts[0].submeshes
+		before := [][]string{}
+		for _, s := range submeshes {
+			before = append(before, testTriangleSet(&m, m.indices[s.offset:s.offset+s.count]))
+		}
+
+		stats := m.Optimize(options)
+		if stats.ACMRAfter >= stats.ACMRBefore || stats.ACMRAfter > 0.8 || stats.ATVRAfter >= stats.ATVRBefore {
+			t.Errorf("%+v: the cache efficiency didn't improve enough: %v", options, stats)
+		}
+		if acmr, atvr := CacheEfficiency(m.indices, len(m.positions)/3, optimizeDefaultCacheSize); acmr != stats.ACMRAfter || atvr != stats.ATVRAfter {
+			t.Errorf("%+v: expected ACMR %v and ATVR %v, got %v", options, acmr, atvr, stats)
+		}
+		// Every submesh still draws the same triangles with the same winding
+		for i, s := range submeshes {
+			if !testSameTriangles(testTriangleSet(&m, m.indices[s.offset:s.offset+s.count]), before[i]) {
+				t.Errorf("%+v: submesh %d draws different triangles", options, i)
+			}
+		}
+	}
+}
+
+func TestCacheEfficiency(t *testing.T) {
+	tests := []struct {
+		indices    []uint32
+		cacheSize  int
+		acmr, atvr float32
+	}{
+		{[]uint32{0, 1, 2}, 16, 3, 1},
+		{[]uint32{0, 1, 2, 2, 1, 3}, 16, 2, 1},
+		// With a cache of 3 vertices, vertex 0 is evicted by 3 before it is used again
+		{[]uint32{0, 1, 2, 1, 2, 3, 3, 2, 0}, 3, 5.0 / 3, 5.0 / 4},
+		{nil, 16, 0, 0},
+	}
+	for _, test := range tests {
+		acmr, atvr := CacheEfficiency(test.indices, 4, test.cacheSize)
+		if acmr != test.acmr || atvr != test.atvr {
+			t.Errorf("%v: expected ACMR %v and ATVR %v, got %v and %v", test.indices, test.acmr, test.atvr, acmr, atvr)
+		}
+	}
+}
+
+func TestOptimizeOverdraw(t *testing.T) {
+	// The faces with the largest distance from the center come last in the index buffer, so the sort has to move them to the front
+	m := testBoxMesh(8, mgl32.Vec3{1, 2, 8})
+	local := make([]int32, len(m.positions)/3)
+	for i := range local {
+		local[i] = -1
+	}
+	optimizeVertexCache(m.indices, local, optimizeDefaultCacheSize)
+	cacheOrder := append([]uint32{}, m.indices...)
+	triangles := testTriangleSet(&m, m.indices)
+	acmr, _ := CacheEfficiency(m.indices, len(m.positions)/3, optimizeDefaultCacheSize)
+
+	optimizeOverdraw(m.indices, &m, optimizeDefaultCacheSize, optimizeDefaultThreshold)
+	if !testSameTriangles(testTriangleSet(&m, m.indices), triangles) {
+		t.Fatal("The sort for overdraw changed the triangles")
+	}
+	if sortedACMR, _ := CacheEfficiency(m.indices, len(m.positions)/3, optimizeDefaultCacheSize); sortedACMR > acmr*optimizeDefaultThreshold {
+		t.Errorf("The sort for overdraw made the ACMR %v worse than the threshold allows from %v", sortedACMR, acmr)
+	}
+
+	// The sort moves whole clusters, so the result consists of runs of consecutive triangles of the cache order
+	position := map[[3]uint32]int{}
+	for i := 0; i < len(cacheOrder); i += 3 {
+		position[[3]uint32{cacheOrder[i], cacheOrder[i+1], cacheOrder[i+2]}] = i / 3
+	}
+	runs := [][2]int{}
+	for i := 0; i < len(m.indices); i += 3 {
+		p := position[[3]uint32{m.indices[i], m.indices[i+1], m.indices[i+2]}]
+		if len(runs) > 0 && runs[len(runs)-1][1] == p {
+			runs[len(runs)-1][1]++
+		} else {
+			runs = append(runs, [2]int{p, p + 1})
+		}
+	}
+	if len(runs) < 2 {
+		t.Fatal("The sort for overdraw didn't reorder any clusters")
+	}
+
+	// The runs are drawn from the outermost to the innermost, measured like the clusters along their normal from the center
+	center := mgl32.Vec3{0.5, 1, 4}
+	previous := float32(0)
+	for i, r := range runs {
+		normal, centroid, area := mgl32.Vec3{}, mgl32.Vec3{}, float32(0)
+		for tr := r[0]; tr < r[1]; tr++ {
+			p0, p1, p2 := m.position(cacheOrder[3*tr]), m.position(cacheOrder[3*tr+1]), m.position(cacheOrder[3*tr+2])
+			n := p1.Sub(p0).Cross(p2.Sub(p0))
+			normal = normal.Add(n)
+			centroid = centroid.Add(p0.Add(p1).Add(p2).Mul(n.Len() / 3))
+			area += n.Len()
+		}
+		key := centroid.Mul(1 / area).Sub(center).Dot(normal.Normalize())
+		if i > 0 && key > previous+1e-4 {
+			t.Errorf("Run %d at %v is drawn after run %d at %v", i, key, i-1, previous)
+		}
+		previous = key
+	}
+}
+
+func TestOptimizeVertexFetch(t *testing.T) {
+	m := testSeamGrid(12)
+	for v := 0; v < len(m.positions)/3; v++ {
+		m.colors = append(m.colors, m.positions[3*v]/12, m.positions[3*v+1]/12, 0, 1)
+	}
+	testShuffleTriangles(&m, 2)
+	m.GenerateLODs(LODOptions{Levels: 1, Ratio: 0.25})
+	// An unused vertex is moved to the end
+	m.positions = append([]float32{-1, -1, -1}, m.positions...)
+	m.normals = append([]float32{0, 0, 1}, m.normals...)
+	m.textureCoords = append([]float32{0, 0}, m.textureCoords...)
+	m.colors = append([]float32{1, 0, 0, 1}, m.colors...)
+	for i := range m.indices {
+		m.indices[i]++
+	}
+	for i := range m.lods[0].indices {
+		m.lods[0].indices[i]++
+	}
+	corners := make([]string, len(m.indices))
+	for i, v := range m.indices {
+		corners[i] = testCorner(&m, v)
+	}
+	lodCorners := make([]string, len(m.lods[0].indices))
+	for i, v := range m.lods[0].indices {
+		lodCorners[i] = testCorner(&m, v)
+	}
+
+	m.optimizeVertexFetch()
+	vertexCount := len(m.positions) / 3
+	if len(m.normals) != vertexCount*3 || len(m.textureCoords) != vertexCount*2 || len(m.colors) != vertexCount*4 {
+		t.Fatal("The vertex attributes have different lengths")
+	}
+	// The vertices are in the order of their first use
+	next := uint32(0)
+	for i, v := range m.indices {
+		if v > next {
+			t.Fatalf("Index %d uses vertex %d before vertex %d", i, v, next)
+		}
+		if v == next {
+			next++
+		}
+	}
+	if unused := testCorner(&m, uint32(vertexCount-1)); unused != "[-1 -1 -1][0 0 1][0 0][1 0 0 1]" {
+		t.Errorf("Expected the unused vertex at the end, got %s", unused)
+	}
+	// Every corner still has the same attributes
+	for i, v := range m.indices {
+		if c := testCorner(&m, v); c != corners[i] {
+			t.Fatalf("Corner %d changed from %s to %s", i, corners[i], c)
+		}
+	}
+	for i, v := range m.lods[0].indices {
+		if c := testCorner(&m, v); c != lodCorners[i] {
+			t.Fatalf("Corner %d of the level of detail changed from %s to %s", i, lodCorners[i], c)
+		}
+	}
+}
+
+func TestParseOBJOptimized(t *testing.T) {
+	// A grid of triangles in random order, so optimizing changes the cache efficiency
+	const n = 20
+	var obj strings.Builder
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			fmt.Fprintf(&obj, "v %d %d 0\n", x, y)
+		}
+	}
+	faces := []string{}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			a := y*(n+1) + x + 1
+			faces = append(faces, fmt.Sprintf("f %d %d %d\n", a, a+1, a+n+2), fmt.Sprintf("f %d %d %d\n", a, a+n+2, a+n+1))
+		}
+	}
+	rand.New(rand.NewSource(3)).Shuffle(len(faces), func(i, j int) { faces[i], faces[j] = faces[j], faces[i] })
+	obj.WriteString(strings.Join(faces, ""))
+
+	unoptimized, err := ParseOBJ(strings.NewReader(obj.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := CacheEfficiency(unoptimized.indices, len(unoptimized.positions)/3, optimizeDefaultCacheSize)
+	for _, workers := range []int{1, 4} {
+		calls := []OptimizeStats{}
+		options := ObjOptions{Workers: workers, Optimize: &OptimizeOptions{}, Optimized: func(stats OptimizeStats) { calls = append(calls, stats) }}
+		mesh, err := ParseOBJWithOptions(strings.NewReader(obj.String()), "", options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(calls) != 1 {
+			t.Fatalf("%d workers: Optimized was called %d times", workers, len(calls))
+		}
+		after, _ := CacheEfficiency(mesh.indices, len(mesh.positions)/3, optimizeDefaultCacheSize)
+		if calls[0].ACMRBefore != before || calls[0].ACMRAfter != after || after >= before {
+			t.Errorf("%d workers: expected the ACMR to go from %v to %v, got %+v", workers, before, after, calls[0])
+		}
+	}
+}
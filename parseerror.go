@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError describes an invalid line of a parsed file
+type ParseError struct {
+	File   string
+	Line   int
+	Column int
+	Token  string
+	Reason string
+	Err    error
+}
+
+// Error returns the error in the form file:line:column: reason or line n:column: reason if the file is unknown
+func (e *ParseError) Error() string {
+	location := fmt.Sprintf("line %d", e.Line)
+	if e.File != "" {
+		location = fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+	if e.Column > 0 {
+		location += fmt.Sprintf(":%d", e.Column)
+	}
+	msg := location + ": " + e.Reason
+	if e.Token != "" {
+		msg += fmt.Sprintf(" %q", e.Token)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error, e.g. a *strconv.NumError
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// withReason returns a copy of the error with the given reason and underlying error
+func (e *ParseError) withReason(reason string, err error) *ParseError {
+	withReason := *e
+	withReason.Reason = reason
+	withReason.Err = err
+	return &withReason
+}
+
+// withField returns a copy of the error that points to the field with the given index of a line split by splitFields
+func (e *ParseError) withField(fields []string, columns []int, field int) *ParseError {
+	withField := *e
+	withField.Token = fields[field]
+	withField.Column = columns[field]
+	return &withField
+}
+
+// ParseErrors is a list of errors collected while parsing a file
+type ParseErrors []*ParseError
+
+// Error returns all errors, one per line
+func (e ParseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the collected errors so they can be inspected with errors.As
+func (e ParseErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// splitFields splits a line at whitespace like strings.Fields and also returns the one based column of every field.
+// The results are appended to fields and columns, which allows reusing them for every line
+func splitFields(l string, fields []string, columns []int) ([]string, []int) {
+	start := -1
+	for i := 0; i <= len(l); i++ {
+		if i == len(l) || l[i] == ' ' || l[i] == '\t' || l[i] == '\r' || l[i] == '\v' || l[i] == '\f' {
+			if start >= 0 {
+				fields = append(fields, l[start:i])
+				columns = append(columns, start+1)
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	return fields, columns
+}
@@ -0,0 +1,57 @@
+package main
+
+// ModelPart represents a named object or group of a model, like the wheels of a car.
+// Parts can be hidden or drawn separately, e.g. with the transform of their own entity
+type ModelPart struct {
+	name      string
+	object    string
+	submeshes []Submesh
+	hidden    bool
+}
+
+// SetHidden sets whether the part is skipped when the whole model is drawn
+func (p *ModelPart) SetHidden(hidden bool) {
+	p.hidden = hidden
+}
+
+// Part returns the first part with the given name or nil if the model has no such part
+func (m *Model) Part(name string) *ModelPart {
+	for i := range m.parts {
+		if m.parts[i].name == name {
+			return &m.parts[i]
+		}
+	}
+	return nil
+}
+
+// ObjectParts returns all parts that belong to the object with the given name
+func (m *Model) ObjectParts(object string) []*ModelPart {
+	parts := []*ModelPart{}
+	for i := range m.parts {
+		if m.parts[i].object == object {
+			parts = append(parts, &m.parts[i])
+		}
+	}
+	return parts
+}
+
+// closeSubmesh sets the index count of the last submesh of the last part and removes the submesh if it is empty
+func closeSubmesh(parts []ModelPart, numIndices int32) {
+	part := &parts[len(parts)-1]
+	if len(part.submeshes) == 0 {
+		return
+	}
+	last := &part.submeshes[len(part.submeshes)-1]
+	last.count = numIndices - last.offset
+	if last.count == 0 {
+		part.submeshes = part.submeshes[:len(part.submeshes)-1]
+	}
+}
+
+// removeEmptyPart removes the last part if it does not contain any submeshes
+func removeEmptyPart(parts []ModelPart) []ModelPart {
+	if len(parts) > 0 && len(parts[len(parts)-1].submeshes) == 0 {
+		return parts[:len(parts)-1]
+	}
+	return parts
+}
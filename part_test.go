@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestModelParts(t *testing.T) {
+	model := Model{parts: []ModelPart{{name: "car", object: "car"}, {name: "wheels", object: "car"}, {name: "tree", object: "tree"}}}
+	if part := model.Part("wheels"); part != &model.parts[1] {
+		t.Fatalf("Part %v", part)
+	}
+	if model.Part("house") != nil {
+		t.Fatal("Expected no part")
+	}
+	if parts := model.ObjectParts("car"); len(parts) != 2 || parts[0] != &model.parts[0] || parts[1] != &model.parts[1] {
+		t.Fatalf("Object parts %v", parts)
+	}
+}
+
+func TestCloseSubmesh(t *testing.T) {
+	parts := []ModelPart{{name: "a", submeshes: []Submesh{{offset: 0}, {offset: 6}}}}
+	closeSubmesh(parts, 9)
+	if len(parts[0].submeshes) != 2 || parts[0].submeshes[1].count != 3 {
+		t.Fatalf("Submeshes %+v", parts[0].submeshes)
+	}
+	// A submesh without indices, e.g. after two usemtl in a row, is removed and leaves an empty part
+	parts = append(parts, ModelPart{name: "b", submeshes: []Submesh{{offset: 9}}})
+	closeSubmesh(parts, 9)
+	if len(parts[1].submeshes) != 0 {
+		t.Fatalf("Submeshes %+v", parts[1].submeshes)
+	}
+	if parts = removeEmptyPart(parts); len(parts) != 1 || parts[0].name != "a" {
+		t.Fatalf("Parts %+v", parts)
+	}
+	if parts = removeEmptyPart(parts); len(parts) != 1 {
+		t.Fatal("Removed a part with submeshes")
+	}
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// plyType is the type of a property of a .ply file
+type plyType int
+
+const (
+	plyInt8 plyType = iota
+	plyUint8
+	plyInt16
+	plyUint16
+	plyInt32
+	plyUint32
+	plyFloat32
+	plyFloat64
+)
+
+// plyTypes maps the type names of .ply headers, including the old names, to types
+var plyTypes = map[string]plyType{
+	"char": plyInt8, "int8": plyInt8,
+	"uchar": plyUint8, "uint8": plyUint8,
+	"short": plyInt16, "int16": plyInt16,
+	"ushort": plyUint16, "uint16": plyUint16,
+	"int": plyInt32, "int32": plyInt32,
+	"uint": plyUint32, "uint32": plyUint32,
+	"float": plyFloat32, "float32": plyFloat32,
+	"double": plyFloat64, "float64": plyFloat64,
+}
+
+// size returns the size of a value of the type in binary files
+func (t plyType) size() int {
+	return [...]int{1, 1, 2, 2, 4, 4, 4, 8}[t]
+}
+
+// maxValue returns the largest value of an integer type, which maps to 1 for colors
+func (t plyType) maxValue() float64 {
+	return [...]float64{math.MaxInt8, math.MaxUint8, math.MaxInt16, math.MaxUint16, math.MaxInt32, math.MaxUint32, 1, 1}[t]
+}
+
+// plyProperty is a property of an element. Lists have a count type and the type of their items
+type plyProperty struct {
+	name      string
+	typ       plyType
+	list      bool
+	countType plyType
+}
+
+// plyElement is an element of a .ply file with its properties
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+// The maximum number of elements that are allocated up front. It protects against huge allocations when reading corrupt headers
+const plyMaxPreallocate = 1 << 20
+
+// plyDecoder reads the values of the body of a .ply file. In ASCII files every element is on its own line
+type plyDecoder struct {
+	r     *bufio.Reader
+	file  string
+	ascii bool
+	order binary.ByteOrder
+	buf   [8]byte
+
+	line    int
+	fields  []string
+	columns []int
+	field   int
+}
+
+// LoadPLY parses an ASCII or binary .ply file into a mesh without uploading it
+func LoadPLY(file string) (Mesh, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Mesh{}, err
+	}
+	defer f.Close()
+	return ParsePLY(f, file)
+}
+
+// ParsePLY parses .ply data into a mesh. The vertices are used as they are, together with their colors.
+// Polygons are triangulated and missing normals are generated. Files without faces become a point cloud with a single submesh of points.
+// The file name is only used for error messages
+func ParsePLY(r io.Reader, file string) (Mesh, error) {
+	d := &plyDecoder{r: bufio.NewReader(r), file: file}
+	elements, err := d.readHeader()
+	if err != nil {
+		return Mesh{}, err
+	}
+
+	mesh := Mesh{}
+	hasVertices, hasFaces := false, false
+	for _, element := range elements {
+		switch element.name {
+		case "vertex":
+			if err := d.readVertices(element, &mesh); err != nil {
+				return Mesh{}, err
+			}
+			hasVertices = true
+		case "face":
+			if !hasVertices {
+				return Mesh{}, fmt.Errorf("Faces before vertices in %s", file)
+			}
+			if err := d.readFaces(element, &mesh); err != nil {
+				return Mesh{}, err
+			}
+			hasFaces = true
+		default:
+			if err := d.skipElement(element); err != nil {
+				return Mesh{}, err
+			}
+		}
+	}
+
+	vertexCount := len(mesh.positions) / 3
+	if !hasFaces && vertexCount > 0 {
+		// Files without faces are point clouds, e.g. from scans
+		mesh.elementIndices = make([]uint32, vertexCount)
+		for i := range mesh.elementIndices {
+			mesh.elementIndices[i] = uint32(i)
+		}
+		mesh.parts = []ModelPart{{submeshes: []Submesh{{count: int32(vertexCount), mode: PrimitivePoints}}}}
+	}
+	if mesh.normals == nil {
+		mesh.normals = smoothNormals(mesh.positions, mesh.indices)
+	}
+	if mesh.textureCoords == nil {
+		mesh.textureCoords = make([]float32, vertexCount*2)
+	}
+	return mesh, nil
+}
+
+// errorAt creates a ParseError for the field with the given index of the current line. Use -1 if the whole line is invalid
+func (d *plyDecoder) errorAt(field int, reason string, err error) *ParseError {
+	parseErr := &ParseError{File: d.file, Line: d.line, Reason: reason, Err: err}
+	if field >= 0 && field < len(d.fields) {
+		parseErr.Column = d.columns[field]
+		parseErr.Token = d.fields[field]
+	} else {
+		parseErr.Token = strings.Join(d.fields, " ")
+	}
+	return parseErr
+}
+
+// readLine reads the next line and splits it into fields
+func (d *plyDecoder) readLine() error {
+	l, err := d.r.ReadString('\n')
+	if err == io.EOF && l != "" {
+		err = nil
+	}
+	if err == io.EOF {
+		return &ParseError{File: d.file, Line: d.line + 1, Reason: "Unexpected end of file"}
+	}
+	if err != nil {
+		return err
+	}
+	d.line++
+	d.fields, d.columns = splitFields(strings.TrimSuffix(l, "\n"), d.fields[:0], d.columns[:0])
+	d.field = 0
+	return nil
+}
+
+// readHeader reads the header up to end_header and returns the elements it declares
+func (d *plyDecoder) readHeader() ([]plyElement, error) {
+	if err := d.readLine(); err != nil {
+		return nil, err
+	}
+	if len(d.fields) != 1 || d.fields[0] != "ply" {
+		return nil, d.errorAt(-1, "Not a .ply file", nil)
+	}
+
+	elements := []plyElement{}
+	hasFormat := false
+	for {
+		if err := d.readLine(); err != nil {
+			return nil, err
+		}
+		if len(d.fields) == 0 {
+			continue
+		}
+		switch d.fields[0] {
+		case "format":
+			if len(d.fields) != 3 {
+				return nil, d.errorAt(-1, "Invalid format", nil)
+			}
+			switch d.fields[1] {
+			case "ascii":
+				d.ascii = true
+			case "binary_little_endian":
+				d.order = binary.LittleEndian
+			case "binary_big_endian":
+				d.order = binary.BigEndian
+			default:
+				return nil, d.errorAt(1, "Unsupported format", nil)
+			}
+			hasFormat = true
+		case "comment", "obj_info":
+		case "element":
+			if len(d.fields) != 3 {
+				return nil, d.errorAt(-1, "Invalid element", nil)
+			}
+			count, err := strconv.Atoi(d.fields[2])
+			if err != nil || count < 0 {
+				return nil, d.errorAt(2, "Invalid element count", err)
+			}
+			elements = append(elements, plyElement{name: d.fields[1], count: count})
+		case "property":
+			if len(elements) == 0 {
+				return nil, d.errorAt(-1, "Property without element", nil)
+			}
+			property, err := d.parseProperty()
+			if err != nil {
+				return nil, err
+			}
+			e := &elements[len(elements)-1]
+			e.properties = append(e.properties, property)
+		case "end_header":
+			if !hasFormat {
+				return nil, d.errorAt(-1, "Missing format", nil)
+			}
+			return elements, nil
+		default:
+			return nil, d.errorAt(0, "Unknown header keyword", nil)
+		}
+	}
+}
+
+// parseProperty parses a property line of the header
+func (d *plyDecoder) parseProperty() (plyProperty, error) {
+	if len(d.fields) == 5 && d.fields[1] == "list" {
+		countType, ok := plyTypes[d.fields[2]]
+		if !ok || countType == plyFloat32 || countType == plyFloat64 {
+			return plyProperty{}, d.errorAt(2, "Invalid list count type", nil)
+		}
+		typ, ok := plyTypes[d.fields[3]]
+		if !ok {
+			return plyProperty{}, d.errorAt(3, "Unknown type", nil)
+		}
+		return plyProperty{name: d.fields[4], typ: typ, list: true, countType: countType}, nil
+	}
+	if len(d.fields) != 3 {
+		return plyProperty{}, d.errorAt(-1, "Invalid property", nil)
+	}
+	typ, ok := plyTypes[d.fields[1]]
+	if !ok {
+		return plyProperty{}, d.errorAt(1, "Unknown type", nil)
+	}
+	return plyProperty{name: d.fields[2], typ: typ}, nil
+}
+
+// beginElement starts reading a single element. In ASCII files it reads the next non-empty line
+func (d *plyDecoder) beginElement() error {
+	if !d.ascii {
+		return nil
+	}
+	for {
+		if err := d.readLine(); err != nil {
+			return err
+		}
+		if len(d.fields) > 0 {
+			return nil
+		}
+	}
+}
+
+// endElement finishes reading a single element. In ASCII files the line must not contain more values
+func (d *plyDecoder) endElement() error {
+	if d.ascii && d.field < len(d.fields) {
+		return d.errorAt(d.field, "Too many values", nil)
+	}
+	return nil
+}
+
+// value reads the next value of the given type
+func (d *plyDecoder) value(t plyType) (float64, error) {
+	if d.ascii {
+		if d.field >= len(d.fields) {
+			return 0, d.errorAt(-1, "Missing value", nil)
+		}
+		v, err := strconv.ParseFloat(d.fields[d.field], 64)
+		if err != nil {
+			return 0, d.errorAt(d.field, "Invalid number", err)
+		}
+		d.field++
+		return v, nil
+	}
+
+	b := d.buf[:t.size()]
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("Unexpected end of file in %s", d.file)
+		}
+		return 0, err
+	}
+	switch t {
+	case plyInt8:
+		return float64(int8(b[0])), nil
+	case plyUint8:
+		return float64(b[0]), nil
+	case plyInt16:
+		return float64(int16(d.order.Uint16(b))), nil
+	case plyUint16:
+		return float64(d.order.Uint16(b)), nil
+	case plyInt32:
+		return float64(int32(d.order.Uint32(b))), nil
+	case plyUint32:
+		return float64(d.order.Uint32(b)), nil
+	case plyFloat32:
+		return float64(math.Float32frombits(d.order.Uint32(b))), nil
+	default:
+		return math.Float64frombits(d.order.Uint64(b)), nil
+	}
+}
+
+// listCount reads the number of items of a list
+func (d *plyDecoder) listCount(p plyProperty) (int, error) {
+	v, err := d.value(p.countType)
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 || v != math.Trunc(v) {
+		if d.ascii {
+			return 0, d.errorAt(d.field-1, "Invalid list count", nil)
+		}
+		return 0, fmt.Errorf("Invalid list count %v in %s", v, d.file)
+	}
+	return int(v), nil
+}
+
+// skipList reads and discards a list
+func (d *plyDecoder) skipList(p plyProperty) error {
+	count, err := d.listCount(p)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		if _, err := d.value(p.typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipElement reads and discards all instances of an element
+func (d *plyDecoder) skipElement(element plyElement) error {
+	for i := 0; i < element.count; i++ {
+		if err := d.beginElement(); err != nil {
+			return err
+		}
+		for _, p := range element.properties {
+			var err error
+			if p.list {
+				err = d.skipList(p)
+			} else {
+				_, err = d.value(p.typ)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := d.endElement(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plyVertexAttribute describes which properties of a vertex are stored in an attribute of the mesh
+type plyVertexAttribute struct {
+	names [][]string
+	data  *[]float32
+	// The properties of the vertex element that are used, or -1 for a missing optional component
+	properties []int
+	// If colors is set, integer values are mapped to [0, 1]
+	colors bool
+}
+
+// readVertices reads the vertex element. Positions are required, while normals, texture coordinates and colors are read if present
+func (d *plyDecoder) readVertices(element plyElement, mesh *Mesh) error {
+	attributes := []*plyVertexAttribute{
+		{names: [][]string{{"x"}, {"y"}, {"z"}}, data: &mesh.positions},
+		{names: [][]string{{"nx"}, {"ny"}, {"nz"}}, data: &mesh.normals},
+		{names: [][]string{{"s", "u", "texture_u", "texture_s"}, {"t", "v", "texture_v", "texture_t"}}, data: &mesh.textureCoords},
+		{names: [][]string{{"red", "diffuse_red", "r"}, {"green", "diffuse_green", "g"}, {"blue", "diffuse_blue", "b"}, {"alpha", "a"}}, data: &mesh.colors, colors: true},
+	}
+	values := make([]float64, len(element.properties))
+	used := []*plyVertexAttribute{}
+	for _, a := range attributes {
+		a.properties = make([]int, len(a.names))
+		found := 0
+		for i, names := range a.names {
+			a.properties[i] = -1
+			for j, p := range element.properties {
+				if !p.list && containsString(names, p.name) {
+					a.properties[i] = j
+					found++
+					break
+				}
+			}
+		}
+		// Only the alpha channel of colors is optional
+		required := len(a.names)
+		if a.colors {
+			required = 3
+		}
+		if found >= required {
+			*a.data = make([]float32, 0, len(a.names)*plyPreallocate(element.count))
+			used = append(used, a)
+		} else if a.data == &mesh.positions {
+			return fmt.Errorf("Missing vertex positions in %s", d.file)
+		}
+	}
+
+	for i := 0; i < element.count; i++ {
+		if err := d.beginElement(); err != nil {
+			return err
+		}
+		for j, p := range element.properties {
+			var err error
+			if p.list {
+				err = d.skipList(p)
+			} else {
+				values[j], err = d.value(p.typ)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := d.endElement(); err != nil {
+			return err
+		}
+
+		for _, a := range used {
+			for k, property := range a.properties {
+				v := float32(1)
+				if property >= 0 {
+					v = float32(values[property])
+					if a.colors {
+						v = float32(values[property] / element.properties[property].typ.maxValue())
+					}
+				}
+				// Texture coordinates are flipped like the ones of .obj files
+				if a.data == &mesh.textureCoords && k == 1 {
+					v = 1 - v
+				}
+				*a.data = append(*a.data, v)
+			}
+		}
+	}
+	return nil
+}
+
+// readFaces reads the face element and triangulates the polygons
+func (d *plyDecoder) readFaces(element plyElement, mesh *Mesh) error {
+	indexProperty := -1
+	for i, p := range element.properties {
+		if p.list && (p.name == "vertex_indices" || p.name == "vertex_index") {
+			indexProperty = i
+		}
+	}
+	if indexProperty < 0 {
+		return fmt.Errorf("Missing vertex indices of faces in %s", d.file)
+	}
+
+	vertexCount := len(mesh.positions) / 3
+	mesh.indices = make([]uint32, 0, 3*plyPreallocate(element.count))
+	face := []uint32{}
+	polygon := []mgl32.Vec3{}
+	for i := 0; i < element.count; i++ {
+		if err := d.beginElement(); err != nil {
+			return err
+		}
+		for j, p := range element.properties {
+			if j != indexProperty {
+				var err error
+				if p.list {
+					err = d.skipList(p)
+				} else {
+					_, err = d.value(p.typ)
+				}
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			count, err := d.listCount(p)
+			if err != nil {
+				return err
+			}
+			face = face[:0]
+			for k := 0; k < count; k++ {
+				v, err := d.value(p.typ)
+				if err != nil {
+					return err
+				}
+				if v < 0 || int(v) >= vertexCount || v != math.Trunc(v) {
+					if d.ascii {
+						return d.errorAt(d.field-1, fmt.Sprintf("Index %v out of range", v), nil)
+					}
+					return fmt.Errorf("Index %v of face %d out of range in %s", v, i, d.file)
+				}
+				face = append(face, uint32(v))
+			}
+		}
+		if err := d.endElement(); err != nil {
+			return err
+		}
+		if len(face) < 3 {
+			continue
+		}
+
+		triangles := singleTriangle
+		if len(face) > 3 {
+			polygon = polygon[:0]
+			for _, index := range face {
+				polygon = append(polygon, mgl32.Vec3{mesh.positions[3*index], mesh.positions[3*index+1], mesh.positions[3*index+2]})
+			}
+			triangles = triangulatePolygon(polygon)
+		}
+		for _, triangle := range triangles {
+			mesh.indices = append(mesh.indices, face[triangle[0]], face[triangle[1]], face[triangle[2]])
+		}
+	}
+	return nil
+}
+
+// plyPreallocate returns the number of elements to allocate up front for an element count of the header
+func plyPreallocate(count int) int {
+	if count > plyMaxPreallocate {
+		return plyMaxPreallocate
+	}
+	return count
+}
+
+// containsString returns true if the list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testPLYHeader is the header of a quad with vertex colors, followed by an element the loader skips
+const testPLYHeader = `ply
+format %s 1.0
+comment A quad with colors
+element vertex 4
+property float x
+property float y
+property float z
+property uchar red
+property uchar green
+property uchar blue
+element face 1
+property list uchar int vertex_indices
+element extra 1
+property list uchar float values
+end_header
+`
+
+// testPLYBinary returns the quad of testPLYHeader in the binary format with the given byte order
+func testPLYBinary(order binary.ByteOrder) []byte {
+	format := "binary_little_endian"
+	if order == binary.BigEndian {
+		format = "binary_big_endian"
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, testPLYHeader, format)
+	for i, p := range [][3]float32{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}} {
+		binary.Write(&b, order, p)
+		b.Write([]byte{255, byte(i * 50), 0})
+	}
+	b.WriteByte(4)
+	binary.Write(&b, order, []int32{0, 1, 2, 3})
+	b.WriteByte(2)
+	binary.Write(&b, order, []float32{1, 2})
+	return b.Bytes()
+}
+
+func TestParsePLY(t *testing.T) {
+	ascii := fmt.Sprintf(testPLYHeader, "ascii") + "0 0 0 255 0 0\n1 0 0 255 50 0\n1 1 0 255 100 0\n0 1 0 255 150 0\n4 0 1 2 3\n2 1 2\n"
+	mesh, err := ParsePLY(strings.NewReader(ascii), "test.ply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The quad is triangulated, the colors are converted to floats and the missing normals are generated
+	if len(mesh.indices) != 6 || len(mesh.colors) != 16 || mesh.colors[3] != 1 || mesh.colors[5] != float32(50)/255 ||
+		mesh.normals[2] != 1 || len(mesh.textureCoords) != 8 {
+		t.Fatalf("Mesh %+v", mesh)
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		binaryMesh, err := ParsePLY(bytes.NewReader(testPLYBinary(order)), "test.ply")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(mesh, binaryMesh) {
+			t.Fatalf("%v mesh differs:\n%+v\n%+v", order, binaryMesh, mesh)
+		}
+	}
+}
+
+func TestParsePLYErrors(t *testing.T) {
+	ascii := fmt.Sprintf(testPLYHeader, "ascii") + "0 0 0 255 0 0\n1 0 0 255 50 0\n1 1 0 255 100 0\n0 1 0 255 150 0\n4 0 1 2 9\n2 1 2\n"
+	_, err := ParsePLY(strings.NewReader(ascii), "test.ply")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 20 || parseErr.Column != 9 {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, err := ParsePLY(bytes.NewReader(testPLYBinary(binary.LittleEndian)[:300]), "test.ply"); err == nil {
+		t.Fatal("Expected an error for a truncated file")
+	}
+	for _, header := range []string{"plx\n", "ply\nformat ascii 1.0\nelement vertex 1\nproperty half x\nend_header\n"} {
+		if _, err := ParsePLY(strings.NewReader(header), "test.ply"); err == nil {
+			t.Errorf("Expected an error for the header %q", header)
+		}
+	}
+}
+
+func TestParsePLYPointCloud(t *testing.T) {
+	ply := "ply\nformat ascii 1.0\nelement vertex 3\nproperty float x\nproperty float y\nproperty float z\nend_header\n0 0 0\n1 0 0\n0 1 0\n"
+	mesh, err := ParsePLY(strings.NewReader(ply), "points.ply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mesh.indices) != 0 || !reflect.DeepEqual(mesh.elementIndices, []uint32{0, 1, 2}) {
+		t.Fatalf("Indices %v, elements %v", mesh.indices, mesh.elementIndices)
+	}
+	if len(mesh.parts) != 1 || len(mesh.parts[0].submeshes) != 1 || mesh.parts[0].submeshes[0].mode != PrimitivePoints {
+		t.Fatalf("Parts %+v", mesh.parts)
+	}
+}
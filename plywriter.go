@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// SavePLY writes the mesh to a .ply file in the binary little endian or the ASCII format
+func SavePLY(file string, mesh *Mesh, binaryFormat bool) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := WritePLY(f, mesh, binaryFormat); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WritePLY writes the vertices and triangles of the mesh in the .ply format. Normals, texture coordinates and colors are written
+// if the mesh has them, with colors as bytes. Parts, materials, lines and points are not part of the format and are dropped
+func WritePLY(w io.Writer, mesh *Mesh, binaryFormat bool) error {
+	bw := bufio.NewWriter(w)
+	vertexCount := len(mesh.positions) / 3
+	hasNormals := len(mesh.normals) == vertexCount*3 && vertexCount > 0
+	hasTextureCoords := len(mesh.textureCoords) == vertexCount*2 && vertexCount > 0
+	hasColors := len(mesh.colors) == vertexCount*4 && vertexCount > 0
+
+	format := "ascii"
+	if binaryFormat {
+		format = "binary_little_endian"
+	}
+	fmt.Fprintf(bw, "ply\nformat %s 1.0\nelement vertex %d\nproperty float x\nproperty float y\nproperty float z\n", format, vertexCount)
+	if hasNormals {
+		bw.WriteString("property float nx\nproperty float ny\nproperty float nz\n")
+	}
+	if hasTextureCoords {
+		bw.WriteString("property float s\nproperty float t\n")
+	}
+	if hasColors {
+		bw.WriteString("property uchar red\nproperty uchar green\nproperty uchar blue\nproperty uchar alpha\n")
+	}
+	fmt.Fprintf(bw, "element face %d\nproperty list uchar uint vertex_indices\nend_header\n", len(mesh.indices)/3)
+
+	floats := make([]float32, 0, 8)
+	colors := make([]uint8, 0, 4)
+	for v := 0; v < vertexCount; v++ {
+		floats = append(floats[:0], mesh.positions[3*v:3*v+3]...)
+		if hasNormals {
+			floats = append(floats, mesh.normals[3*v:3*v+3]...)
+		}
+		if hasTextureCoords {
+			// Texture coordinates are flipped back like in .obj files
+			floats = append(floats, mesh.textureCoords[2*v], 1-mesh.textureCoords[2*v+1])
+		}
+		colors = colors[:0]
+		if hasColors {
+			for _, c := range mesh.colors[4*v : 4*v+4] {
+				colors = append(colors, uint8(math.Round(clampf64(float64(c), 0, 1)*255)))
+			}
+		}
+
+		if binaryFormat {
+			binary.Write(bw, binary.LittleEndian, floats)
+			bw.Write(colors)
+			continue
+		}
+		for i, f := range floats {
+			if i > 0 {
+				bw.WriteString(" ")
+			}
+			bw.WriteString(formatFloat(f))
+		}
+		for _, c := range colors {
+			fmt.Fprintf(bw, " %d", c)
+		}
+		bw.WriteString("\n")
+	}
+
+	for i := 0; i+2 < len(mesh.indices); i += 3 {
+		triangle := mesh.indices[i : i+3]
+		if binaryFormat {
+			bw.WriteByte(3)
+			binary.Write(bw, binary.LittleEndian, triangle)
+			continue
+		}
+		fmt.Fprintf(bw, "3 %d %d %d\n", triangle[0], triangle[1], triangle[2])
+	}
+	return bw.Flush()
+}
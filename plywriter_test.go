@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWritePLYRoundTrip(t *testing.T) {
+	mesh := Mesh{
+		positions:     []float32{0, 0, 0, 1, 0, 0, 0, 1, 0.5},
+		normals:       []float32{0, 0, 1, 0, 0, 1, 0, 0, 1},
+		textureCoords: []float32{0, 1, 1, 0.25, 0.5, 0.5},
+		// Colors are written as bytes, so only multiples of 1/255 survive
+		colors:  []float32{1, 0, 0, 1, 0, 1, 0, 1, 0, 0, 1, 0},
+		indices: []uint32{0, 1, 2},
+	}
+	for _, binaryFormat := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := WritePLY(&buf, &mesh, binaryFormat); err != nil {
+			t.Fatal(err)
+		}
+		written, err := ParsePLY(&buf, "test.ply")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(mesh, written) {
+			t.Fatalf("Binary %v: written mesh differs:\n%+v\n%+v", binaryFormat, mesh, written)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// PrimitiveMode is how the indices of a model or a submesh are assembled into primitives. The zero value is a list of triangles
+type PrimitiveMode uint8
+
+// The primitive modes. Patches are the input of tessellation shaders and have the number of vertices set with SetPatchVertices
+const (
+	PrimitiveTriangles PrimitiveMode = iota
+	PrimitivePoints
+	PrimitiveLines
+	PrimitiveLineStrip
+	PrimitiveTriangleStrip
+	PrimitiveTriangleFan
+	PrimitivePatches
+)
+
+// glMode returns the OpenGL mode of the primitives
+func (p PrimitiveMode) glMode() uint32 {
+	switch p {
+	case PrimitivePoints:
+		return gl.POINTS
+	case PrimitiveLines:
+		return gl.LINES
+	case PrimitiveLineStrip:
+		return gl.LINE_STRIP
+	case PrimitiveTriangleStrip:
+		return gl.TRIANGLE_STRIP
+	case PrimitiveTriangleFan:
+		return gl.TRIANGLE_FAN
+	case PrimitivePatches:
+		return gl.PATCHES
+	}
+	return gl.TRIANGLES
+}
+
+// SetPrimitiveMode sets the primitive mode of a model without parts. Submeshes have their own mode
+func (m *Model) SetPrimitiveMode(mode PrimitiveMode) {
+	m.mode = mode
+}
+
+// SetPatchVertices sets the number of vertices per patch for drawing patches. Without it, patches have the size that was set last, which is 3 by default
+func (m *Model) SetPatchVertices(vertices int32) {
+	m.patchVertices = vertices
+}
+
+// modelParts copies the parts of a mesh for a model whose index buffer has the triangles of the parts at triangleOffset
+// and the line and point elements at elementOffset
+func modelParts(parts []ModelPart, triangleOffset, elementOffset int32) []ModelPart {
+	result := make([]ModelPart, len(parts))
+	for i, p := range parts {
+		result[i] = p
+		result[i].submeshes = make([]Submesh, len(p.submeshes))
+		for j, s := range p.submeshes {
+			if s.mode == PrimitiveTriangles {
+				s.offset += triangleOffset
+			} else {
+				s.offset += elementOffset
+			}
+			result[i].submeshes[j] = s
+		}
+	}
+	return result
+}
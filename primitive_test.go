@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testElementsOBJ has a triangle, polylines and points in three objects, with relative and texture coordinate indices
+const testElementsOBJ = `v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+f 1/1 2/2 3/3
+l 1/1 2/2 3/3 4
+l -1 -2
+p 1 3
+o lines
+l 2 4
+g empty
+o points
+p 4 -3
+`
+
+func TestParseOBJElements(t *testing.T) {
+	mesh, err := ParseOBJ(strings.NewReader(testElementsOBJ))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The polylines are split into segments, the empty group is dropped
+	if len(mesh.indices) != 3 || len(mesh.elementIndices) != 6+2+2+2+2 {
+		t.Fatalf("Indices %v, elements %v", mesh.indices, mesh.elementIndices)
+	}
+	if len(mesh.parts) != 3 || mesh.parts[1].name != "lines" || mesh.parts[2].name != "points" {
+		t.Fatalf("Parts %+v", mesh.parts)
+	}
+	expected := [][]Submesh{
+		{{offset: 0, count: 3}, {offset: 0, count: 8, mode: PrimitiveLines}, {offset: 8, count: 2, mode: PrimitivePoints}},
+		{{offset: 10, count: 2, mode: PrimitiveLines}},
+		{{offset: 12, count: 2, mode: PrimitivePoints}},
+	}
+	for i, p := range mesh.parts {
+		if !reflect.DeepEqual(p.submeshes, expected[i]) {
+			t.Errorf("Submeshes of %s %+v instead of %+v", p.name, p.submeshes, expected[i])
+		}
+	}
+	// Element vertices have all attributes of the mesh, and the segments connect the right positions
+	for i, v := range mesh.elementIndices {
+		if int(v) >= len(mesh.positions)/3 || len(mesh.normals) != len(mesh.positions) || len(mesh.textureCoords)/2 != len(mesh.positions)/3 {
+			t.Fatalf("Element %d uses vertex %d out of range", i, v)
+		}
+	}
+	if p := mesh.position(mesh.elementIndices[6]); p[0] != 0 || p[1] != 1 {
+		t.Errorf("The segment of the relative line starts at %v instead of the last vertex", p)
+	}
+
+	for workers := 2; workers < 6; workers++ {
+		parallel, err := ParseOBJWithOptions(strings.NewReader(testElementsOBJ), "", ObjOptions{Workers: workers})
+		if err != nil || !reflect.DeepEqual(mesh, parallel) {
+			t.Fatalf("%d workers: the mesh differs (%v)", workers, err)
+		}
+	}
+}
+
+func TestParseOBJElementErrors(t *testing.T) {
+	for _, obj := range []string{"v 0 0 0\nl 1\n", "v 0 0 0\np\n", "v 0 0 0\np 2\n", "v 0 0 0\nl 1 x\n"} {
+		if _, err := ParseOBJ(strings.NewReader(obj)); err == nil {
+			t.Errorf("Expected an error for %q", obj)
+		}
+	}
+}
+
+func TestMeshElementsRoundTrip(t *testing.T) {
+	mesh, err := ParseOBJ(strings.NewReader(testElementsOBJ))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := EncodeMesh(&b, &mesh); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeMesh(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.elementIndices, mesh.elementIndices) || !reflect.DeepEqual(decoded.parts, mesh.parts) {
+		t.Fatalf("Decoded mesh differs:\n%+v\n%+v", decoded, mesh)
+	}
+
+	b.Reset()
+	if err := WriteOBJ(&b, &mesh, ""); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ParseOBJ(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written.elementIndices) != len(mesh.elementIndices) || len(written.parts) != len(mesh.parts) {
+		t.Fatalf("Written mesh differs:\n%+v\n%+v", written, mesh)
+	}
+}
+
+func TestModelPartsOffsets(t *testing.T) {
+	parts := []ModelPart{{name: "a", submeshes: []Submesh{{offset: 0, count: 6}, {offset: 2, count: 4, mode: PrimitiveLines}}}}
+	result := modelParts(parts, 10, 100)
+	if result[0].submeshes[0].offset != 10 || result[0].submeshes[1].offset != 102 {
+		t.Fatalf("Submeshes %+v", result[0].submeshes)
+	}
+	if parts[0].submeshes[0].offset != 0 || parts[0].submeshes[1].offset != 2 {
+		t.Fatal("modelParts changed the parts of the mesh")
+	}
+}
+
+func TestElementsAfterProcessing(t *testing.T) {
+	mesh, err := ParseOBJ(strings.NewReader(testElementsOBJ))
+	if err != nil {
+		t.Fatal(err)
+	}
+	corners := make([]string, len(mesh.elementIndices))
+	for i, v := range mesh.elementIndices {
+		corners[i] = testCorner(&mesh, v)
+	}
+	// The vertex fetch order includes the elements, which keep their vertices
+	mesh.Optimize(OptimizeOptions{VertexFetch: true})
+	for i, v := range mesh.elementIndices {
+		if c := testCorner(&mesh, v); c != corners[i] {
+			t.Fatalf("Element %d changed from %s to %s", i, corners[i], c)
+		}
+	}
+	// Vertices only used by elements get tangents as well
+	if err := mesh.GenerateTangents(); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range mesh.elementIndices {
+		if int(v) >= len(mesh.tangents)/4 || len(mesh.tangents)/4 != len(mesh.positions)/3 {
+			t.Fatalf("Element %d uses vertex %d without a tangent", i, v)
+		}
+		if c := testCorner(&mesh, v); c != corners[i] {
+			t.Fatalf("Element %d changed from %s to %s", i, corners[i], c)
+		}
+	}
+}
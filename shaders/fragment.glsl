@@ -3,21 +3,32 @@
 in vec2 texCoords;
 in vec3 surfaceNormal;
 in vec3 toLightVector;
+in vec4 surfaceColor;
+in vec4 surfaceTangent;
 
 out vec4 color;
 
 layout(binding = 0) uniform sampler2D tex;
+layout(binding = 1) uniform sampler2D normalMap;
 uniform float hasTexture;
+uniform float hasNormalMap;
+uniform vec3 diffuseColor;
 
 void main() {
 	vec3 unitNormal = normalize(surfaceNormal);
+	if (hasNormalMap==1) {
+		// Like MikkTSpace, the interpolated tangent space is not normalized before the normal map is applied
+		vec3 bitangent = surfaceTangent.w * cross(surfaceNormal, surfaceTangent.xyz);
+		vec3 mapNormal = texture(normalMap, texCoords).xyz * 2.0 - 1.0;
+		unitNormal = normalize(mapNormal.x * surfaceTangent.xyz + mapNormal.y * bitangent + mapNormal.z * surfaceNormal);
+	}
 	vec3 unitLightVector = normalize(toLightVector);
 	float diffuseStrength = dot(unitLightVector, unitNormal);
 	diffuseStrength = max(diffuseStrength, 0.2);
 
 	if (hasTexture==1) {
-		color = texture(tex, texCoords) * diffuseStrength;
+		color = texture(tex, texCoords) * vec4(diffuseColor, 1.0) * surfaceColor * diffuseStrength;
 	} else {
-		color = vec4(1.0,1.0,1.0,0.0) * diffuseStrength;
+		color = vec4(diffuseColor, 0.0) * surfaceColor * diffuseStrength;
 	}
 }
\ No newline at end of file
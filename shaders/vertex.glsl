@@ -2,22 +2,32 @@
 layout (location = 0) in vec3 vert;
 layout (location = 1) in vec2 inTexCoords;
 layout (location = 2) in vec3 normal;
+layout (location = 3) in vec4 vertexColor;
+layout (location = 4) in vec4 tangent;
+layout (location = 5) in mat4 instanceMatrix;
+layout (location = 9) in vec4 instanceColor;
 
 out vec2 texCoords;
 out vec3 toLightVector;
 out vec3 surfaceNormal;
+out vec4 surfaceColor;
+out vec4 surfaceTangent;
 
 uniform mat4 modelMatrix;
 uniform mat4 viewMatrix;
 uniform mat4 projectionMatrix;
 uniform vec3 lightPos;
+uniform float instanced;
 
 void main() {
-	vec4 worldPosition = modelMatrix * vec4(vert, 1.0);
+	mat4 model = instanced==1 ? instanceMatrix : modelMatrix;
+	vec4 worldPosition = model * vec4(vert, 1.0);
 	gl_Position = projectionMatrix * viewMatrix * worldPosition;
 	texCoords = inTexCoords;
+	surfaceColor = vertexColor * instanceColor;
 
 	// Todo: load the normal matrix as a uniform variable
-	surfaceNormal = transpose(inverse(mat3(modelMatrix))) * normal;
+	surfaceNormal = transpose(inverse(mat3(model))) * normal;
+	surfaceTangent = vec4(mat3(model) * tangent.xyz, tangent.w);
 	toLightVector = lightPos - worldPosition.xyz;
 }
\ No newline at end of file
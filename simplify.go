@@ -0,0 +1,424 @@
+package main
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// SimplifyOptions configures the simplification of a mesh
+type SimplifyOptions struct {
+	// TargetRatio is the fraction of the triangles to keep
+	TargetRatio float32
+	// MaxError stops the simplification before collapses with a larger error, relative to the size of the mesh. 0 means no limit
+	MaxError float32
+}
+
+// Borders and UV seams are kept in place by planes through their edges that are weighted higher than the surface
+const simplifyBoundaryWeight = 10
+
+// quadric is the symmetric matrix of the quadric error metric, which sums the squared distances to a set of weighted planes
+type quadric struct {
+	a2, ab, ac, ad, b2, bc, bd, c2, cd, d2 float64
+	weight                                 float64
+}
+
+// planeQuadric returns the quadric of the plane with the unit normal n through the point p
+func planeQuadric(n, p mgl32.Vec3, weight float64) quadric {
+	a, b, c := float64(n[0]), float64(n[1]), float64(n[2])
+	d := -(a*float64(p[0]) + b*float64(p[1]) + c*float64(p[2]))
+	return quadric{
+		a * a * weight, a * b * weight, a * c * weight, a * d * weight,
+		b * b * weight, b * c * weight, b * d * weight,
+		c * c * weight, c * d * weight,
+		d * d * weight,
+		weight,
+	}
+}
+
+func (q *quadric) add(o *quadric) {
+	q.a2 += o.a2
+	q.ab += o.ab
+	q.ac += o.ac
+	q.ad += o.ad
+	q.b2 += o.b2
+	q.bc += o.bc
+	q.bd += o.bd
+	q.c2 += o.c2
+	q.cd += o.cd
+	q.d2 += o.d2
+	q.weight += o.weight
+}
+
+// eval returns the weighted sum of the squared distances of the point to the planes
+func (q *quadric) eval(p mgl32.Vec3) float64 {
+	x, y, z := float64(p[0]), float64(p[1]), float64(p[2])
+	e := q.a2*x*x + 2*q.ab*x*y + 2*q.ac*x*z + 2*q.ad*x +
+		q.b2*y*y + 2*q.bc*y*z + 2*q.bd*y +
+		q.c2*z*z + 2*q.cd*z + q.d2
+	return math.Abs(e)
+}
+
+// simplifyCollapse is a candidate edge collapse that moves the position from onto the position to
+type simplifyCollapse struct {
+	cost     float64
+	from, to int32
+	// The versions of both positions when the cost was computed. Collapses with outdated versions are skipped
+	fromVersion, toVersion uint32
+}
+
+type simplifyQueue []simplifyCollapse
+
+func (q simplifyQueue) Len() int            { return len(q) }
+func (q simplifyQueue) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q simplifyQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *simplifyQueue) Push(x interface{}) { *q = append(*q, x.(simplifyCollapse)) }
+func (q *simplifyQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+// simplifier holds the state of a mesh during simplification. Vertices with the same position are collapsed together,
+// so the sides of UV seams stay connected
+type simplifier struct {
+	mesh      *Mesh
+	positions []mgl32.Vec3
+	// The position of every vertex
+	positionOf []int32
+	triangles  [][3]uint32
+	alive      []bool
+	// The triangles around every position. Triangles that were removed are skipped
+	around   [][]int32
+	quadrics []quadric
+	removed  []bool
+	versions []uint32
+	queue    simplifyQueue
+	// Buffers that are reused for every candidate
+	mapping map[uint32]uint32
+}
+
+// Simplify reduces the number of triangles of the mesh with edge collapses that minimize the quadric error metric.
+// Borders and UV seams are preserved. The result shares the vertices of the mesh and only has new indices and parts.
+// It also returns the error of the result relative to the size of the mesh
+func (m *Mesh) Simplify(options SimplifyOptions) (Mesh, float32) {
+	s := newSimplifier(m)
+	target := int(float64(len(s.triangles)) * float64(options.TargetRatio))
+	size := computeAABB(m.positions).Size().Len()
+	maxCost := math.Inf(1)
+	if options.MaxError > 0 {
+		maxCost = float64(options.MaxError * size)
+		maxCost *= maxCost
+	}
+
+	aliveCount := len(s.triangles)
+	maxError := 0.0
+	for aliveCount > target && s.queue.Len() > 0 {
+		c := heap.Pop(&s.queue).(simplifyCollapse)
+		if s.removed[c.from] || s.removed[c.to] || s.versions[c.from] != c.fromVersion || s.versions[c.to] != c.toVersion {
+			continue
+		}
+		if c.cost > maxCost {
+			break
+		}
+		if !s.canCollapse(c.from, c.to) {
+			continue
+		}
+		aliveCount -= s.collapse(c.from, c.to)
+		maxError = math.Max(maxError, c.cost)
+	}
+
+	result := *m
+	result.indices = make([]uint32, 0, aliveCount*3)
+	emit := func(first, end int) {
+		for t := first; t < end; t++ {
+			if s.alive[t] {
+				result.indices = append(result.indices, s.triangles[t][:]...)
+			}
+		}
+	}
+	if len(m.parts) == 0 {
+		emit(0, len(s.triangles))
+	}
+	result.parts = make([]ModelPart, len(m.parts))
+	for i, p := range m.parts {
+		result.parts[i] = p
+		result.parts[i].submeshes = make([]Submesh, len(p.submeshes))
+		for j, sub := range p.submeshes {
+			// Lines and points are kept as they are
+			if sub.mode == PrimitiveTriangles {
+				offset := int32(len(result.indices))
+				emit(int(sub.offset/3), int((sub.offset+sub.count)/3))
+				sub.offset, sub.count = offset, int32(len(result.indices))-offset
+			}
+			result.parts[i].submeshes[j] = sub
+		}
+	}
+	result.lods = nil
+
+	relativeError := float32(0)
+	if size > 0 {
+		relativeError = float32(math.Sqrt(maxError)) / size
+	}
+	return result, relativeError
+}
+
+// newSimplifier welds the vertices by position, computes the quadrics and queues all edge collapses
+func newSimplifier(m *Mesh) *simplifier {
+	s := &simplifier{mesh: m, mapping: map[uint32]uint32{}}
+	vertexCount := len(m.positions) / 3
+	s.positionOf = make([]int32, vertexCount)
+	ids := map[mgl32.Vec3]int32{}
+	for v := 0; v < vertexCount; v++ {
+		p := m.position(uint32(v))
+		id, ok := ids[p]
+		if !ok {
+			id = int32(len(s.positions))
+			ids[p] = id
+			s.positions = append(s.positions, p)
+		}
+		s.positionOf[v] = id
+	}
+
+	positionCount := len(s.positions)
+	s.around = make([][]int32, positionCount)
+	s.quadrics = make([]quadric, positionCount)
+	s.removed = make([]bool, positionCount)
+	s.versions = make([]uint32, positionCount)
+	s.triangles = make([][3]uint32, len(m.indices)/3)
+	s.alive = make([]bool, len(s.triangles))
+
+	// The number of triangles of every edge, by positions and by vertices. Edges of a single triangle are borders,
+	// edges that are shared by position but not by vertices are UV seams
+	type edge [2]int32
+	positionEdges := map[edge]int{}
+	vertexEdges := map[edge]int{}
+	makeEdge := func(a, b int32) edge {
+		if a > b {
+			a, b = b, a
+		}
+		return edge{a, b}
+	}
+	for t := range s.triangles {
+		copy(s.triangles[t][:], m.indices[3*t:3*t+3])
+		s.alive[t] = true
+		for c := 0; c < 3; c++ {
+			a, b := s.triangles[t][c], s.triangles[t][(c+1)%3]
+			positionEdges[makeEdge(s.positionOf[a], s.positionOf[b])]++
+			vertexEdges[makeEdge(int32(a), int32(b))]++
+			s.around[s.positionOf[a]] = append(s.around[s.positionOf[a]], int32(t))
+		}
+	}
+
+	for _, triangle := range s.triangles {
+		p0, p1, p2 := s.positions[s.positionOf[triangle[0]]], s.positions[s.positionOf[triangle[1]]], s.positions[s.positionOf[triangle[2]]]
+		normal := p1.Sub(p0).Cross(p2.Sub(p0))
+		area := float64(normal.Len()) / 2
+		if area == 0 {
+			continue
+		}
+		normal = normal.Normalize()
+		q := planeQuadric(normal, p0, area)
+		for c := 0; c < 3; c++ {
+			s.quadrics[s.positionOf[triangle[c]]].add(&q)
+		}
+
+		for c := 0; c < 3; c++ {
+			a, b := triangle[c], triangle[(c+1)%3]
+			pa, pb := s.positionOf[a], s.positionOf[b]
+			border := positionEdges[makeEdge(pa, pb)] == 1
+			seam := vertexEdges[makeEdge(int32(a), int32(b))] == 1 && !border
+			if !border && !seam {
+				continue
+			}
+			e := s.positions[pb].Sub(s.positions[pa])
+			length := e.Len()
+			if length == 0 {
+				continue
+			}
+			q := planeQuadric(e.Cross(normal).Normalize(), s.positions[pa], float64(length*length)*simplifyBoundaryWeight)
+			s.quadrics[pa].add(&q)
+			s.quadrics[pb].add(&q)
+		}
+	}
+
+	for p := range s.positions {
+		s.queueCollapses(int32(p))
+	}
+	return s
+}
+
+// neighbours returns the positions that share a triangle with the position
+func (s *simplifier) neighbours(p int32) []int32 {
+	neighbours := []int32{}
+	for _, t := range s.around[p] {
+		if !s.alive[t] {
+			continue
+		}
+		for _, v := range s.triangles[t] {
+			if n := s.positionOf[v]; n != p && !containsInt32(neighbours, n) {
+				neighbours = append(neighbours, n)
+			}
+		}
+	}
+	return neighbours
+}
+
+// queueCollapses queues the collapses of all edges of the position in both directions
+func (s *simplifier) queueCollapses(p int32) {
+	for _, n := range s.neighbours(p) {
+		for _, c := range [][2]int32{{p, n}, {n, p}} {
+			q := s.quadrics[c[0]]
+			q.add(&s.quadrics[c[1]])
+			heap.Push(&s.queue, simplifyCollapse{
+				cost:        q.eval(s.positions[c[1]]) / math.Max(q.weight, 1e-30),
+				from:        c[0],
+				to:          c[1],
+				fromVersion: s.versions[c[0]],
+				toVersion:   s.versions[c[1]],
+			})
+		}
+	}
+}
+
+// contains returns true if the triangle uses a vertex at the position
+func (s *simplifier) contains(t int32, p int32) bool {
+	for _, v := range s.triangles[t] {
+		if s.positionOf[v] == p {
+			return true
+		}
+	}
+	return false
+}
+
+// canCollapse checks if the position from can be moved onto to. Every vertex of from must share an edge with exactly one vertex of to,
+// which keeps UV seams intact. Border positions only move along borders and triangles must not flip
+func (s *simplifier) canCollapse(from, to int32) bool {
+	for k := range s.mapping {
+		delete(s.mapping, k)
+	}
+	ambiguous := false
+	shared := 0
+	for _, t := range s.around[from] {
+		if !s.alive[t] || !s.contains(t, to) {
+			continue
+		}
+		shared++
+		var a, b uint32
+		for _, v := range s.triangles[t] {
+			switch s.positionOf[v] {
+			case from:
+				a = v
+			case to:
+				b = v
+			}
+		}
+		if mapped, ok := s.mapping[a]; ok && mapped != b {
+			ambiguous = true
+		}
+		s.mapping[a] = b
+	}
+	if ambiguous || shared == 0 || shared > 2 {
+		return false
+	}
+
+	// Border positions have edges with a single triangle. They may only collapse along such an edge
+	if shared == 2 && s.isBorder(from) {
+		return false
+	}
+
+	for _, t := range s.around[from] {
+		if !s.alive[t] || s.contains(t, to) {
+			continue
+		}
+		var before, after [3]mgl32.Vec3
+		for c, v := range s.triangles[t] {
+			if _, ok := s.mapping[v]; !ok && s.positionOf[v] == from {
+				// A vertex of from without a neighbour in to would be moved off its seam
+				return false
+			}
+			before[c] = s.positions[s.positionOf[v]]
+			after[c] = before[c]
+			if s.positionOf[v] == from {
+				after[c] = s.positions[to]
+			}
+		}
+		n1 := before[1].Sub(before[0]).Cross(before[2].Sub(before[0]))
+		n2 := after[1].Sub(after[0]).Cross(after[2].Sub(after[0]))
+		if n2.Len() == 0 || n1.Dot(n2) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isBorder checks if the position has an edge that belongs to a single triangle
+func (s *simplifier) isBorder(p int32) bool {
+	for _, n := range s.neighbours(p) {
+		count := 0
+		for _, t := range s.around[p] {
+			if s.alive[t] && s.contains(t, n) {
+				count++
+			}
+		}
+		if count == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// collapse moves the position from onto to, using the mapping computed by canCollapse. It returns the number of removed triangles
+func (s *simplifier) collapse(from, to int32) int {
+	removed := 0
+	for _, t := range s.around[from] {
+		if !s.alive[t] {
+			continue
+		}
+		if s.contains(t, to) {
+			s.alive[t] = false
+			removed++
+			continue
+		}
+		for c, v := range s.triangles[t] {
+			if s.positionOf[v] == from {
+				s.triangles[t][c] = s.mapping[v]
+			}
+		}
+		s.around[to] = append(s.around[to], t)
+	}
+	s.around[from] = nil
+	s.removed[from] = true
+	s.quadrics[to].add(&s.quadrics[from])
+	s.versions[to]++
+
+	// Remove the triangles that are gone, so the list does not grow with every collapse
+	alive := s.around[to][:0]
+	for _, t := range s.around[to] {
+		if s.alive[t] {
+			alive = append(alive, t)
+		}
+	}
+	s.around[to] = alive
+
+	for _, n := range s.neighbours(to) {
+		s.versions[n]++
+	}
+	s.queueCollapses(to)
+	for _, n := range s.neighbours(to) {
+		s.queueCollapses(n)
+	}
+	return removed
+}
+
+// containsInt32 returns true if the list contains v
+func containsInt32(list []int32, v int32) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSeamGrid returns a flat grid of n x n quads in two submeshes. The vertices of the middle column are split into two with
+// different texture coordinates, so the grid has a UV seam there
+func testSeamGrid(n int) Mesh {
+	mesh := Mesh{}
+	vertices := map[[3]int]uint32{}
+	vertex := func(x, y, side int) uint32 {
+		if x != n/2 {
+			side = 0
+		}
+		key := [3]int{x, y, side}
+		if v, ok := vertices[key]; ok {
+			return v
+		}
+		v := uint32(len(mesh.positions) / 3)
+		vertices[key] = v
+		mesh.positions = append(mesh.positions, float32(x), float32(y), 0)
+		mesh.normals = append(mesh.normals, 0, 0, 1)
+		mesh.textureCoords = append(mesh.textureCoords, float32(x)/float32(n)+float32(side)*5, float32(y)/float32(n))
+		return v
+	}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			side := 0
+			if x >= n/2 {
+				side = 1
+			}
+			a, b, c, d := vertex(x, y, side), vertex(x+1, y, side), vertex(x+1, y+1, side), vertex(x, y+1, side)
+			mesh.indices = append(mesh.indices, a, b, c, a, c, d)
+		}
+	}
+	half := int32(len(mesh.indices) / 2)
+	mesh.parts = []ModelPart{{name: "grid", submeshes: []Submesh{{offset: 0, count: half}, {offset: half, count: half}}}}
+	return mesh
+}
+
+func TestSimplifyPlane(t *testing.T) {
+	mesh := testSeamGrid(20)
+	simplified, simplifyError := mesh.Simplify(SimplifyOptions{TargetRatio: 0.05})
+	if len(simplified.indices)/3 > 40 || simplifyError > 1e-4 {
+		t.Fatalf("%d triangles with an error of %v", len(simplified.indices)/3, simplifyError)
+	}
+	if len(mesh.indices) != 20*20*6 {
+		t.Fatal("Simplify changed the indices of the mesh")
+	}
+
+	area := float32(0)
+	for i := 0; i < len(simplified.indices); i += 3 {
+		// All corners of a triangle stay on the same side of the seam
+		side := -1
+		for _, v := range simplified.indices[i : i+3] {
+			s := 0
+			if simplified.textureCoords[2*v] >= 4 || simplified.positions[3*v] > 10 {
+				s = 1
+			}
+			if side >= 0 && s != side {
+				t.Fatalf("Triangle %d crosses the seam", i/3)
+			}
+			side = s
+		}
+		a, b, c := simplified.position(simplified.indices[i]), simplified.position(simplified.indices[i+1]), simplified.position(simplified.indices[i+2])
+		normal := b.Sub(a).Cross(c.Sub(a))
+		if normal.Z() <= 0 {
+			t.Fatalf("Triangle %d is flipped or degenerate", i/3)
+		}
+		area += normal.Len() / 2
+	}
+	// The borders are kept, so the triangles still cover the whole grid
+	if math.Abs(float64(area-400)) > 1e-2 {
+		t.Fatalf("Triangles have an area of %v instead of 400", area)
+	}
+
+	submeshes := simplified.parts[0].submeshes
+	if submeshes[0].offset != 0 || submeshes[1].offset != submeshes[0].count || submeshes[0].count+submeshes[1].count != int32(len(simplified.indices)) {
+		t.Fatalf("Submeshes %+v", submeshes)
+	}
+}
+
+func TestSimplifyMaxError(t *testing.T) {
+	mesh := testSeamGrid(10)
+	// Lifting the middle of the grid makes every collapse there change the surface
+	for i := 0; i < len(mesh.positions); i += 3 {
+		x, y := float64(mesh.positions[i])-5, float64(mesh.positions[i+1])-5
+		mesh.positions[i+2] = float32(math.Exp(-(x*x + y*y) / 4))
+	}
+	unlimited, unlimitedError := mesh.Simplify(SimplifyOptions{TargetRatio: 0.1})
+	limited, limitedError := mesh.Simplify(SimplifyOptions{TargetRatio: 0.1, MaxError: unlimitedError / 10})
+	if limitedError > unlimitedError/10 || len(limited.indices) <= len(unlimited.indices) {
+		t.Fatalf("%d triangles with an error of %v, %d without a limit with %v",
+			len(limited.indices)/3, limitedError, len(unlimited.indices)/3, unlimitedError)
+	}
+}
+
+func TestGenerateLODs(t *testing.T) {
+	mesh := testSeamGrid(16)
+	mesh.GenerateLODs(LODOptions{Levels: 3, Ratio: 0.5})
+	if len(mesh.lods) != 3 {
+		t.Fatalf("Expected 3 levels of detail, got %d", len(mesh.lods))
+	}
+	triangles := len(mesh.indices) / 3
+	for i, lod := range mesh.lods {
+		if len(lod.indices)/3 >= triangles {
+			t.Errorf("Level %d has %d triangles, the previous level %d", i+1, len(lod.indices)/3, triangles)
+		}
+		triangles = len(lod.indices) / 3
+		// The levels share the vertices of the full mesh
+		for _, v := range lod.indices {
+			if int(v) >= len(mesh.positions)/3 {
+				t.Fatalf("Level %d uses vertex %d out of range", i+1, v)
+			}
+		}
+		if len(lod.parts) != 1 || len(lod.parts[0].submeshes) != 2 {
+			t.Errorf("Level %d has parts %+v", i+1, lod.parts)
+		}
+	}
+}
+
+func TestModelIndicesLODs(t *testing.T) {
+	mesh, err := ParseOBJ(strings.NewReader(testElementsOBJ))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mesh.lods = []meshLOD{{indices: []uint32{2, 1, 0}, parts: mesh.parts}, {indices: []uint32{0, 2, 1}, parts: mesh.parts}}
+	indices := modelIndices(&mesh)
+	model := Model{}
+	model.setMesh(&mesh)
+	// The index buffer holds the triangles, the elements and every level once, and the model only draws the triangles by default
+	if len(indices) != len(mesh.indices)+len(mesh.elementIndices)+6 || model.size != int32(len(mesh.indices)) {
+		t.Fatalf("%d indices with size %d", len(indices), model.size)
+	}
+	for i, l := range model.lods {
+		if !reflect.DeepEqual(indices[l.offset:l.offset+l.count], mesh.lods[i].indices) {
+			t.Errorf("Level %d draws %v instead of %v", i+1, indices[l.offset:l.offset+l.count], mesh.lods[i].indices)
+		}
+		// The elements of the levels are the elements of the full mesh
+		if s := l.submeshes[1][0]; s.mode != PrimitiveLines || s.offset != int32(len(mesh.indices))+10 {
+			t.Errorf("Level %d has the submeshes %+v", i+1, l.submeshes)
+		}
+	}
+}
+
+func TestSelectLODDistances(t *testing.T) {
+	model := Model{lods: make([]modelLOD, 2)}
+	model.SetLODDistances([]float32{10, 20, 30})
+	tests := []struct {
+		distance float32
+		level    int
+	}{{0, 0}, {9, 0}, {10, 1}, {25, 2}, {100, 2}}
+	for _, test := range tests {
+		if level := model.SelectLOD(test.distance, 1); level != test.level {
+			t.Errorf("Expected level %d at distance %v, got %d", test.level, test.distance, level)
+		}
+	}
+}
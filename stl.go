@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// The size of the header and of a triangle of binary .stl files
+const (
+	stlHeaderSize   = 84
+	stlTriangleSize = 50
+)
+
+// StlOptions configures how .stl files are turned into meshes
+type StlOptions struct {
+	// Vertices that are at most WeldTolerance apart are merged into one. With 0, only identical positions are merged
+	WeldTolerance float32
+	// Triangles that meet at an angle of at most CreaseAngle degrees share their normals. With 0, every triangle is flat
+	CreaseAngle float32
+}
+
+// LoadSTL parses an ASCII or binary .stl file into a mesh without uploading it
+func LoadSTL(file string, options StlOptions) (Mesh, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Mesh{}, err
+	}
+	defer f.Close()
+	return ParseSTL(f, file, options)
+}
+
+// ParseSTL parses .stl data into a mesh. The triangles are welded into an indexed mesh and their normals are computed from the
+// winding order, as the facet normals of many files are unreliable. Every solid of an ASCII file becomes a part of the mesh.
+// The file name is only used for error messages
+func ParseSTL(r io.Reader, file string, options StlOptions) (Mesh, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Mesh{}, err
+	}
+
+	var soup []float32
+	var parts []ModelPart
+	if isBinarySTL(data) {
+		soup, err = parseBinarySTL(data, file)
+	} else if bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("solid")) {
+		soup, parts, err = parseASCIISTL(data, file)
+	} else {
+		err = fmt.Errorf("Invalid .stl file %s", file)
+	}
+	if err != nil {
+		return Mesh{}, err
+	}
+
+	mesh := Mesh{parts: parts}
+	var welded []uint32
+	mesh.positions, welded = weldPositions(soup, options.WeldTolerance)
+	mesh.indices = make([]uint32, 0, len(welded))
+	if len(mesh.parts) == 0 {
+		mesh.indices = appendWeldedTriangles(mesh.indices, welded)
+	}
+	for i := range mesh.parts {
+		s := &mesh.parts[i].submeshes[0]
+		start := len(mesh.indices)
+		mesh.indices = appendWeldedTriangles(mesh.indices, welded[s.offset:s.offset+s.count])
+		s.offset, s.count = int32(start), int32(len(mesh.indices)-start)
+	}
+	// Without a crease angle all triangles are flat, which is what smoothing group 0 does
+	smoothing := normalSmoothing{}
+	if options.CreaseAngle <= 0 {
+		smoothing.groups = make([]uint32, len(mesh.indices)/3)
+	}
+	mesh.generateNormals(NormalOptions{CreaseAngle: options.CreaseAngle}, smoothing)
+	mesh.textureCoords = make([]float32, len(mesh.positions)/3*2)
+	return mesh, nil
+}
+
+// appendWeldedTriangles appends the triangles to indices. Triangles that collapsed while welding are removed
+func appendWeldedTriangles(indices []uint32, triangles []uint32) []uint32 {
+	for i := 0; i+2 < len(triangles); i += 3 {
+		a, b, c := triangles[i], triangles[i+1], triangles[i+2]
+		if a != b && b != c && a != c {
+			indices = append(indices, a, b, c)
+		}
+	}
+	return indices
+}
+
+// isBinarySTL checks if the data is a binary .stl file. Binary files may also start with "solid", so they are detected
+// by a size that matches the triangle count of the header, a missing "solid" or a line after the "solid" line that
+// doesn't start with "facet" or "endsolid" like in ASCII files
+func isBinarySTL(data []byte) bool {
+	if len(data) < stlHeaderSize {
+		return false
+	}
+	expected := stlHeaderSize + uint64(binary.LittleEndian.Uint32(data[80:]))*stlTriangleSize
+	text := bytes.TrimLeft(data, " \t\r\n")
+	if uint64(len(data)) == expected || !bytes.HasPrefix(text, []byte("solid")) {
+		return true
+	}
+	// ASCII files as long as the header have more than one line
+	lineEnd := bytes.IndexByte(text, '\n')
+	if lineEnd < 0 {
+		return true
+	}
+	next := bytes.TrimLeft(text[lineEnd+1:], " \t\r\n")
+	return !bytes.HasPrefix(next, []byte("facet")) && !bytes.HasPrefix(next, []byte("endsolid"))
+}
+
+// parseBinarySTL returns the positions of the corners of all triangles of a binary .stl file. Bytes after the last
+// triangle are ignored
+func parseBinarySTL(data []byte, file string) ([]float32, error) {
+	count := binary.LittleEndian.Uint32(data[80:])
+	if uint64(len(data)) < stlHeaderSize+uint64(count)*stlTriangleSize {
+		return nil, fmt.Errorf("Truncated .stl file %s: %d triangles need %d bytes, got %d", file, count, stlHeaderSize+uint64(count)*stlTriangleSize, len(data))
+	}
+	soup := make([]float32, 0, int(count)*9)
+	for i := 0; i < int(count); i++ {
+		// Every triangle starts with the facet normal, which is skipped, and ends with two attribute bytes
+		triangle := data[stlHeaderSize+i*stlTriangleSize+12:]
+		for j := 0; j < 9; j++ {
+			soup = append(soup, math.Float32frombits(binary.LittleEndian.Uint32(triangle[j*4:])))
+		}
+	}
+	return soup, nil
+}
+
+// parseASCIISTL returns the positions of the corners of all triangles of an ASCII .stl file and a part for every solid.
+// The submesh of every part holds the range of its corners in the soup
+func parseASCIISTL(data []byte, file string) ([]float32, []ModelPart, error) {
+	soup := []float32{}
+	parts := []ModelPart{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), objMaxLineLength)
+
+	var fields []string
+	var columns []int
+	errorAt := func(line, field int, reason string, err error) *ParseError {
+		parseErr := &ParseError{File: file, Line: line, Reason: reason, Err: err}
+		if field >= 0 && field < len(fields) {
+			parseErr.Column = columns[field]
+			parseErr.Token = fields[field]
+		} else {
+			parseErr.Token = strings.Join(fields, " ")
+		}
+		return parseErr
+	}
+
+	inSolid := false
+	vertices := 0
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields, columns = splitFields(scanner.Text(), fields[:0], columns[:0])
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "solid":
+			if inSolid {
+				return nil, nil, errorAt(line, 0, "Nested solid", nil)
+			}
+			inSolid = true
+			name := strings.Join(fields[1:], " ")
+			parts = append(parts, ModelPart{name: name, object: name, submeshes: []Submesh{{offset: int32(len(soup) / 3)}}})
+		case "endsolid":
+			if !inSolid {
+				return nil, nil, errorAt(line, 0, "Unexpected endsolid", nil)
+			}
+			inSolid = false
+			s := &parts[len(parts)-1].submeshes[0]
+			s.count = int32(len(soup)/3) - s.offset
+		case "facet":
+			vertices = 0
+		case "vertex":
+			if !inSolid || vertices == 3 {
+				return nil, nil, errorAt(line, 0, "Unexpected vertex", nil)
+			}
+			if len(fields) != 4 {
+				return nil, nil, errorAt(line, -1, "Invalid vertex", nil)
+			}
+			for i := 1; i < 4; i++ {
+				f, err := strconv.ParseFloat(fields[i], 32)
+				if err != nil {
+					return nil, nil, errorAt(line, i, "Invalid number", err)
+				}
+				soup = append(soup, float32(f))
+			}
+			vertices++
+		case "endfacet":
+			if vertices != 3 {
+				return nil, nil, errorAt(line, 0, "Facet without three vertices", nil)
+			}
+		case "outer", "endloop":
+		default:
+			return nil, nil, errorAt(line, 0, "Unknown keyword", nil)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if inSolid {
+		return nil, nil, &ParseError{File: file, Line: line, Reason: "Missing endsolid"}
+	}
+	return soup, parts, nil
+}
+
+// weldPositions merges positions that are at most tolerance apart. It returns the unique positions and the index of every input position
+func weldPositions(positions []float32, tolerance float32) ([]float32, []uint32) {
+	unique := make([]float32, 0, len(positions)/2)
+	indices := make([]uint32, len(positions)/3)
+
+	if tolerance <= 0 {
+		seen := map[mgl32.Vec3]uint32{}
+		for i := range indices {
+			p := mgl32.Vec3{positions[3*i], positions[3*i+1], positions[3*i+2]}
+			index, ok := seen[p]
+			if !ok {
+				index = uint32(len(unique) / 3)
+				seen[p] = index
+				unique = append(unique, p[:]...)
+			}
+			indices[i] = index
+		}
+		return unique, indices
+	}
+
+	// Positions are sorted into a grid with cells of the size of the tolerance, so only the neighbouring cells have to be searched
+	type cell [3]int64
+	grid := map[cell][]uint32{}
+	cellOf := func(p mgl32.Vec3) cell {
+		return cell{int64(math.Floor(float64(p[0] / tolerance))), int64(math.Floor(float64(p[1] / tolerance))), int64(math.Floor(float64(p[2] / tolerance)))}
+	}
+	for i := range indices {
+		p := mgl32.Vec3{positions[3*i], positions[3*i+1], positions[3*i+2]}
+		c := cellOf(p)
+		found := false
+		for x := c[0] - 1; x <= c[0]+1 && !found; x++ {
+			for y := c[1] - 1; y <= c[1]+1 && !found; y++ {
+				for z := c[2] - 1; z <= c[2]+1 && !found; z++ {
+					for _, index := range grid[cell{x, y, z}] {
+						q := mgl32.Vec3{unique[3*index], unique[3*index+1], unique[3*index+2]}
+						if p.Sub(q).Len() <= tolerance {
+							indices[i] = index
+							found = true
+							break
+						}
+					}
+				}
+			}
+		}
+		if !found {
+			index := uint32(len(unique) / 3)
+			grid[c] = append(grid[c], index)
+			unique = append(unique, p[:]...)
+			indices[i] = index
+		}
+	}
+	return unique, indices
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testCubeSoup returns the corners of the 12 triangles of a unit cube
+func testCubeSoup() []float32 {
+	corners := [][3]float32{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}, {0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}}
+	quads := [][4]int{{0, 3, 2, 1}, {4, 5, 6, 7}, {0, 1, 5, 4}, {2, 3, 7, 6}, {1, 2, 6, 5}, {0, 4, 7, 3}}
+	soup := []float32{}
+	for _, q := range quads {
+		for _, i := range []int{q[0], q[1], q[2], q[0], q[2], q[3]} {
+			soup = append(soup, corners[i][:]...)
+		}
+	}
+	return soup
+}
+
+// testBinarySTL returns a binary .stl file with the triangles of the soup and the given header
+func testBinarySTL(soup []float32, header string) []byte {
+	var b bytes.Buffer
+	b.WriteString(header)
+	b.Write(make([]byte, 80-len(header)))
+	binary.Write(&b, binary.LittleEndian, uint32(len(soup)/9))
+	for i := 0; i < len(soup); i += 9 {
+		binary.Write(&b, binary.LittleEndian, [3]float32{})
+		binary.Write(&b, binary.LittleEndian, soup[i:i+9])
+		b.Write([]byte{0, 0})
+	}
+	return b.Bytes()
+}
+
+func TestParseBinarySTL(t *testing.T) {
+	data := testBinarySTL(testCubeSoup(), "binary")
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"exact size", data},
+		{"trailing bytes", append(data[:len(data):len(data)], 1, 2, 3)},
+		{"solid header", testBinarySTL(testCubeSoup(), "solid cube")},
+		// The size doesn't match, but the header isn't followed by a line with a facet
+		{"solid header and trailing bytes", append(testBinarySTL(testCubeSoup(), "solid cube"), 1, 2, 3)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mesh, err := ParseSTL(bytes.NewReader(test.data), "cube.stl", StlOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mesh.positions) != 24*3 || len(mesh.indices) != 36 {
+				t.Fatalf("%d vertices and %d indices", len(mesh.positions)/3, len(mesh.indices))
+			}
+		})
+	}
+
+	smooth, err := ParseSTL(bytes.NewReader(data), "cube.stl", StlOptions{CreaseAngle: 180})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(smooth.positions) != 8*3 {
+		t.Fatalf("%d smooth vertices", len(smooth.positions)/3)
+	}
+	// The smooth normal of the corner at the origin points away from the center of the cube
+	for i := 0; i < 3; i++ {
+		if math.Abs(float64(smooth.normals[i])+1/math.Sqrt(3)) > 1e-5 {
+			t.Fatalf("Normal %v", smooth.normals[:3])
+		}
+	}
+
+	for _, header := range []string{"binary", "solid cube"} {
+		full := testBinarySTL(testCubeSoup(), header)
+		if _, err := ParseSTL(bytes.NewReader(full[:len(full)-60]), "cube.stl", StlOptions{}); err == nil || !strings.Contains(err.Error(), "Truncated") {
+			t.Fatalf("Expected an error for a truncated file with the header %q, got %v", header, err)
+		}
+	}
+}
+
+func TestParseASCIISTL(t *testing.T) {
+	soup := testCubeSoup()
+	var b strings.Builder
+	b.WriteString("solid cube\n")
+	for i := 0; i < len(soup); i += 9 {
+		b.WriteString(" facet normal 0 0 0\n  outer loop\n")
+		for j := i; j < i+9; j += 3 {
+			x := soup[j]
+			// Offset one corner slightly, so it is only merged with its copies when welding
+			if j == 0 {
+				x += 1e-5
+			}
+			fmt.Fprintf(&b, "   vertex %g %g %g\n", x, soup[j+1], soup[j+2])
+		}
+		b.WriteString("  endloop\n endfacet\n")
+	}
+	b.WriteString("endsolid cube\n")
+
+	mesh, err := ParseSTL(strings.NewReader(b.String()), "cube.stl", StlOptions{WeldTolerance: 1e-4, CreaseAngle: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mesh.positions) != 24*3 || len(mesh.parts) != 1 || mesh.parts[0].name != "cube" || mesh.parts[0].submeshes[0].count != 36 {
+		t.Fatalf("%d vertices, parts %+v", len(mesh.positions)/3, mesh.parts)
+	}
+	mesh, err = ParseSTL(strings.NewReader(b.String()), "cube.stl", StlOptions{CreaseAngle: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mesh.positions) != 25*3 {
+		t.Fatalf("%d vertices without welding", len(mesh.positions)/3)
+	}
+
+	// Names with UTF-8 characters don't make the file binary
+	utf8 := strings.Replace(b.String(), "solid cube", "solid Würfel — 立方体", 1)
+	mesh, err = ParseSTL(strings.NewReader(utf8), "cube.stl", StlOptions{CreaseAngle: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mesh.parts) != 1 || mesh.parts[0].name != "Würfel — 立方体" || len(mesh.indices) != 36 {
+		t.Fatalf("Parts %+v with %d indices", mesh.parts, len(mesh.indices))
+	}
+
+	if _, err := ParseSTL(strings.NewReader("solid x\nfacet normal 0 0 1\nouter loop\nvertex 1 2 q\n"), "cube.stl", StlOptions{}); err == nil {
+		t.Fatal("Expected an error for an invalid vertex")
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// The smallest normal float32, which MikkTSpace uses to detect degenerate texture coordinates
+const tangentEpsilon = 1.17549435e-38
+
+// tangentVertexKey identifies the vertices that MikkTSpace merges because all their attributes are equal
+type tangentVertexKey struct {
+	position mgl32.Vec3
+	normal   mgl32.Vec3
+	texCoord mgl32.Vec2
+}
+
+// GenerateTangents computes a tangent for every vertex the way MikkTSpace does, which is the tangent space of Blender and Substance,
+// so normal maps baked there look the same. The fourth component of a tangent is the sign of the bitangent, which is
+// sign * cross(normal, tangent). Vertices used by triangles with mirrored texture coordinates are split. The mesh needs normals and texture coordinates
+func (m *Mesh) GenerateTangents() error {
+	vertexCount := len(m.positions) / 3
+	if len(m.normals) != vertexCount*3 || len(m.textureCoords) != vertexCount*2 {
+		return errors.New("Generating tangents needs normals and texture coordinates")
+	}
+	// The loaders flip texture coordinates for OpenGL, so they are flipped back to get the bitangent of the authoring tools
+	texCoord := func(v uint32) mgl32.Vec2 {
+		return mgl32.Vec2{m.textureCoords[2*v], 1 - m.textureCoords[2*v+1]}
+	}
+	normal := func(v uint32) mgl32.Vec3 {
+		return mgl32.Vec3{m.normals[3*v], m.normals[3*v+1], m.normals[3*v+2]}
+	}
+
+	// The signed area of the texture coordinates, which is negative for mirrored triangles
+	signedArea := func(i0, i1, i2 uint32) float32 {
+		t21 := texCoord(i1).Sub(texCoord(i0))
+		t31 := texCoord(i2).Sub(texCoord(i0))
+		return t21.X()*t31.Y() - t21.Y()*t31.X()
+	}
+
+	// The tangent of every triangle and whether its texture coordinates keep the orientation of the triangle
+	triangleCount := len(m.indices) / 3
+	tangents := make([]mgl32.Vec3, triangleCount)
+	preserving := make([]bool, triangleCount)
+	degenerate := make([]bool, triangleCount)
+	for t := 0; t < triangleCount; t++ {
+		i0, i1, i2 := m.indices[3*t], m.indices[3*t+1], m.indices[3*t+2]
+		t21 := texCoord(i1).Sub(texCoord(i0))
+		t31 := texCoord(i2).Sub(texCoord(i0))
+		d1 := m.position(i1).Sub(m.position(i0))
+		d2 := m.position(i2).Sub(m.position(i0))
+		area := signedArea(i0, i1, i2)
+		preserving[t] = area > 0
+		degenerate[t] = math.Abs(float64(area)) <= tangentEpsilon
+		if degenerate[t] {
+			continue
+		}
+		tangent := d1.Mul(t31.Y()).Sub(d2.Mul(t21.Y()))
+		if l := tangent.Len(); l > tangentEpsilon {
+			sign := float32(1)
+			if !preserving[t] {
+				sign = -1
+			}
+			tangents[t] = tangent.Mul(sign / l)
+		}
+	}
+
+	// Corners of vertices with equal attributes are grouped by the orientation of their triangle.
+	// Triangles with degenerate texture coordinates join any group of their vertex
+	type groupKey struct {
+		vertex     tangentVertexKey
+		preserving bool
+	}
+	vertexKey := func(v uint32) tangentVertexKey {
+		return tangentVertexKey{m.position(v), normal(v), texCoord(v)}
+	}
+	groups := map[groupKey]int{}
+	groupPreserving := []bool{}
+	cornerGroups := make([]int, len(m.indices))
+	addGroup := func(key groupKey) int {
+		group, ok := groups[key]
+		if !ok {
+			group = len(groupPreserving)
+			groups[key] = group
+			groupPreserving = append(groupPreserving, key.preserving)
+		}
+		return group
+	}
+	for corner, v := range m.indices {
+		if t := corner / 3; !degenerate[t] {
+			cornerGroups[corner] = addGroup(groupKey{vertexKey(v), preserving[t]})
+		}
+	}
+	for corner, v := range m.indices {
+		if !degenerate[corner/3] {
+			continue
+		}
+		key := vertexKey(v)
+		if group, ok := groups[groupKey{key, true}]; ok {
+			cornerGroups[corner] = group
+		} else if group, ok := groups[groupKey{key, false}]; ok {
+			cornerGroups[corner] = group
+		} else {
+			cornerGroups[corner] = addGroup(groupKey{key, true})
+		}
+	}
+
+	// The tangent of a group is the average of the tangents of its triangles projected onto the plane of the normal,
+	// weighted by the angle of the corners
+	groupTangents := make([]mgl32.Vec3, len(groupPreserving))
+	for corner, v := range m.indices {
+		t := corner / 3
+		if degenerate[t] {
+			continue
+		}
+		n := normal(v)
+		tangent := projectOntoPlane(tangents[t], n)
+		p := m.position(v)
+		edge1 := projectOntoPlane(m.position(m.indices[3*t+(corner+1)%3]).Sub(p), n)
+		edge2 := projectOntoPlane(m.position(m.indices[3*t+(corner+2)%3]).Sub(p), n)
+		angle := float32(math.Acos(clampf64(float64(edge1.Dot(edge2)), -1, 1)))
+		groupTangents[cornerGroups[corner]] = groupTangents[cornerGroups[corner]].Add(tangent.Mul(angle))
+	}
+
+	// Every vertex is split into one vertex per group of its corners, created in the order of their first use
+	type split struct {
+		vertex uint32
+		group  int
+	}
+	splits := map[split]uint32{}
+	firstSplits := map[uint32]uint32{}
+	attributes := []meshFileAttribute{}
+	for _, attribute := range meshFileAttributes(m) {
+		if attribute.id != meshAttributeTangent && len(*attribute.data) > 0 {
+			attributes = append(attributes, attribute)
+		}
+	}
+	data := make([][]float32, len(attributes))
+	result := make([]float32, 0, vertexCount*4)
+	indices := make([]uint32, len(m.indices))
+	for corner, v := range m.indices {
+		s := split{v, cornerGroups[corner]}
+		index, ok := splits[s]
+		if !ok {
+			index = uint32(len(result) / 4)
+			splits[s] = index
+			if _, ok := firstSplits[v]; !ok {
+				firstSplits[v] = index
+			}
+			tangent := groupTangents[s.group]
+			if l := tangent.Len(); l > tangentEpsilon {
+				tangent = tangent.Mul(1 / l)
+			} else {
+				tangent = perpendicular(normal(v))
+			}
+			sign := float32(1)
+			if !groupPreserving[s.group] {
+				sign = -1
+			}
+			result = append(result, tangent[0], tangent[1], tangent[2], sign)
+			for i, attribute := range attributes {
+				n := int(attribute.components)
+				data[i] = append(data[i], (*attribute.data)[int(v)*n:(int(v)+1)*n]...)
+			}
+		}
+		indices[corner] = index
+	}
+	// Vertices that are only used by lines and points get any tangent that is perpendicular to their normal
+	for i, v := range m.elementIndices {
+		index, ok := firstSplits[v]
+		if !ok {
+			index = uint32(len(result) / 4)
+			firstSplits[v] = index
+			tangent := perpendicular(normal(v))
+			result = append(result, tangent[0], tangent[1], tangent[2], 1)
+			for j, attribute := range attributes {
+				n := int(attribute.components)
+				data[j] = append(data[j], (*attribute.data)[int(v)*n:(int(v)+1)*n]...)
+			}
+		}
+		m.elementIndices[i] = index
+	}
+
+	// The levels of detail use the split of every vertex that matches the orientation of their triangles.
+	// The keys are computed from the old vertices, so this has to happen before the attributes are replaced
+	for l := range m.lods {
+		lodIndices := m.lods[l].indices
+		remapped := make([]uint32, len(lodIndices))
+		for corner, v := range lodIndices {
+			t := corner - corner%3
+			remapped[corner] = firstSplits[v]
+			key := groupKey{vertexKey(v), signedArea(lodIndices[t], lodIndices[t+1], lodIndices[t+2]) > 0}
+			if group, ok := groups[key]; ok {
+				if index, ok := splits[split{v, group}]; ok {
+					remapped[corner] = index
+				}
+			}
+		}
+		m.lods[l].indices = remapped
+	}
+
+	for i, attribute := range attributes {
+		*attribute.data = data[i]
+	}
+	m.tangents = result
+	m.indices = indices
+	return nil
+}
+
+// projectOntoPlane projects v onto the plane with the normal n and normalizes it. It returns the zero vector if the projection is too short
+func projectOntoPlane(v, n mgl32.Vec3) mgl32.Vec3 {
+	v = v.Sub(n.Mul(n.Dot(v)))
+	if l := v.Len(); l > tangentEpsilon {
+		return v.Mul(1 / l)
+	}
+	return mgl32.Vec3{}
+}
+
+// perpendicular returns any unit vector that is perpendicular to n
+func perpendicular(n mgl32.Vec3) mgl32.Vec3 {
+	axis := mgl32.Vec3{1, 0, 0}
+	if math.Abs(float64(n.X())) > 0.9 {
+		axis = mgl32.Vec3{0, 1, 0}
+	}
+	if p := projectOntoPlane(axis, n); p.Len() > 0 {
+		return p
+	}
+	return axis
+}
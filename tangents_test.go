@@ -0,0 +1,199 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// testQuadMesh returns a unit quad in the XY plane facing +Z. uv maps a position to the texture coordinates of the authoring tools,
+// which are flipped for OpenGL like the loaders do
+func testQuadMesh(uv func(x, y float32) (float32, float32)) Mesh {
+	m := Mesh{
+		positions: []float32{0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 1, 0},
+		normals:   []float32{0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1},
+		indices:   []uint32{0, 1, 2, 0, 2, 3},
+	}
+	for i := 0; i < len(m.positions); i += 3 {
+		u, v := uv(m.positions[i], m.positions[i+1])
+		m.textureCoords = append(m.textureCoords, u, 1-v)
+	}
+	return m
+}
+
+// testTangent returns the tangent and the bitangent sign of a vertex
+func testTangent(m *Mesh, v uint32) (mgl32.Vec3, float32) {
+	return mgl32.Vec3{m.tangents[4*v], m.tangents[4*v+1], m.tangents[4*v+2]}, m.tangents[4*v+3]
+}
+
+// testCorners returns the position and texture coordinates used by every corner, which must not change when vertices are split
+func testCorners(m *Mesh) [][5]float32 {
+	corners := make([][5]float32, len(m.indices))
+	for i, v := range m.indices {
+		p := m.position(v)
+		corners[i] = [5]float32{p[0], p[1], p[2], m.textureCoords[2*v], m.textureCoords[2*v+1]}
+	}
+	return corners
+}
+
+func TestGenerateTangentsQuad(t *testing.T) {
+	tests := []struct {
+		name    string
+		uv      func(x, y float32) (float32, float32)
+		tangent mgl32.Vec3
+		sign    float32
+	}{
+		{"identity", func(x, y float32) (float32, float32) { return x, y }, mgl32.Vec3{1, 0, 0}, 1},
+		{"mirrored", func(x, y float32) (float32, float32) { return 1 - x, y }, mgl32.Vec3{-1, 0, 0}, -1},
+		{"rotated", func(x, y float32) (float32, float32) { return y, 1 - x }, mgl32.Vec3{0, 1, 0}, 1},
+		{"scaled", func(x, y float32) (float32, float32) { return 4 * x, y / 2 }, mgl32.Vec3{1, 0, 0}, 1},
+	}
+	for _, test := range tests {
+		m := testQuadMesh(test.uv)
+		if err := m.GenerateTangents(); err != nil {
+			t.Fatal(test.name, err)
+		}
+		if len(m.positions) != 12 || len(m.tangents) != 16 {
+			t.Fatalf("%s: expected 4 vertices with tangents, got %d positions and %d tangents", test.name, len(m.positions), len(m.tangents))
+		}
+		for v := uint32(0); v < 4; v++ {
+			// The bitangent sign * cross(normal, tangent) must point along increasing v
+			tangent, sign := testTangent(&m, v)
+			if !testVecNear(tangent, test.tangent) || sign != test.sign {
+				t.Errorf("%s: vertex %d has tangent %v with sign %v, expected %v with sign %v", test.name, v, tangent, sign, test.tangent, test.sign)
+			}
+		}
+	}
+}
+
+func TestGenerateTangentsMirroredSeam(t *testing.T) {
+	// Two quads side by side whose texture coordinates are mirrored at the shared edge x = 1, like the halves of a face
+	m := Mesh{
+		positions:     []float32{0, 0, 0, 1, 0, 0, 2, 0, 0, 0, 1, 0, 1, 1, 0, 2, 1, 0},
+		normals:       []float32{0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1},
+		textureCoords: []float32{0, 1, 1, 1, 0, 1, 0, 0, 1, 0, 0, 0},
+		indices:       []uint32{0, 1, 4, 0, 4, 3, 1, 2, 5, 1, 5, 4},
+	}
+	corners := testCorners(&m)
+	if err := m.GenerateTangents(); err != nil {
+		t.Fatal(err)
+	}
+	// The seam vertices 1 and 4 are split, the others are kept
+	if len(m.positions) != 8*3 || len(m.normals) != 8*3 || len(m.textureCoords) != 8*2 || len(m.tangents) != 8*4 {
+		t.Fatalf("Expected 8 vertices, got %d positions and %d tangents", len(m.positions)/3, len(m.tangents)/4)
+	}
+	for i, c := range testCorners(&m) {
+		if c != corners[i] {
+			t.Fatalf("Corner %d changed from %v to %v", i, corners[i], c)
+		}
+	}
+	// The tangents of the two sides are not averaged at the seam
+	for corner, v := range m.indices {
+		want, wantSign := mgl32.Vec3{1, 0, 0}, float32(1)
+		if corner >= 6 {
+			want, wantSign = mgl32.Vec3{-1, 0, 0}, -1
+		}
+		if tangent, sign := testTangent(&m, v); !testVecNear(tangent, want) || sign != wantSign {
+			t.Errorf("Corner %d has tangent %v with sign %v, expected %v with sign %v", corner, tangent, sign, want, wantSign)
+		}
+	}
+}
+
+func TestGenerateTangentsDegenerate(t *testing.T) {
+	m := Mesh{
+		// A valid triangle, a triangle sharing its edge with collinear texture coordinates,
+		// a triangle whose texture coordinates are a single point and a triangle without area
+		positions: []float32{0, 0, 0, 1, 0, 0, 0, 1, 0, 1, 1, 0, 2, 0, 0, 3, 0, 0, 2, 1, 0, 5, 5, 0, 5, 5, 0, 5, 5, 0},
+		normals:   []float32{0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1},
+		textureCoords: []float32{0, 0, 1, 0, 0, 1, 0.5, 0.5,
+			0.3, 0.3, 0.3, 0.3, 0.3, 0.3,
+			0.2, 0.2, 0.4, 0.4, 0.6, 0.2},
+		indices: []uint32{0, 1, 2, 1, 3, 2, 4, 5, 6, 7, 8, 9},
+	}
+	if err := m.GenerateTangents(); err != nil {
+		t.Fatal(err)
+	}
+	for v := 0; v < len(m.tangents)/4; v++ {
+		tangent, sign := testTangent(&m, uint32(v))
+		for _, c := range m.tangents[4*v : 4*v+4] {
+			if math.IsNaN(float64(c)) || math.IsInf(float64(c), 0) {
+				t.Fatalf("Vertex %d has tangent %v", v, m.tangents[4*v:4*v+4])
+			}
+		}
+		if math.Abs(float64(tangent.Len()-1)) > 1e-5 || math.Abs(float64(tangent.Z())) > 1e-5 || (sign != 1 && sign != -1) {
+			t.Errorf("Vertex %d has tangent %v with sign %v, expected a unit vector perpendicular to the normal", v, tangent, sign)
+		}
+	}
+}
+
+func TestGenerateTangentsParts(t *testing.T) {
+	// The mirrored halves are separate parts, whose index ranges must still draw the same corners after the seam is split
+	m := Mesh{
+		positions:     []float32{0, 0, 0, 1, 0, 0, 2, 0, 0, 0, 1, 0, 1, 1, 0, 2, 1, 0},
+		normals:       []float32{0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1},
+		textureCoords: []float32{0, 1, 1, 1, 0, 1, 0, 0, 1, 0, 0, 0},
+		indices:       []uint32{0, 1, 4, 0, 4, 3, 1, 2, 5, 1, 5, 4},
+		parts: []ModelPart{
+			{name: "left", submeshes: []Submesh{{offset: 0, count: 6}}},
+			{name: "right", submeshes: []Submesh{{offset: 6, count: 6}}},
+		},
+	}
+	corners := testCorners(&m)
+	if err := m.GenerateTangents(); err != nil {
+		t.Fatal(err)
+	}
+	after := testCorners(&m)
+	for _, part := range m.parts {
+		for _, s := range part.submeshes {
+			for i := s.offset; i < s.offset+s.count; i++ {
+				if after[i] != corners[i] {
+					t.Errorf("Part %s draws %v instead of %v at index %d", part.name, after[i], corners[i], i)
+				}
+				if int(m.indices[i]) >= len(m.positions)/3 {
+					t.Errorf("Part %s uses vertex %d out of range", part.name, m.indices[i])
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateTangentsErrors(t *testing.T) {
+	m := Mesh{positions: []float32{0, 0, 0}}
+	if m.GenerateTangents() == nil {
+		t.Error("Expected an error for a mesh without normals and texture coordinates")
+	}
+	empty := Mesh{}
+	if err := empty.GenerateTangents(); err != nil || len(empty.tangents) != 0 {
+		t.Errorf("Expected no tangents and no error for an empty mesh, got %v", err)
+	}
+}
+
+func TestGenerateTangentsLODs(t *testing.T) {
+	// A level of detail with one triangle on each side of the mirrored seam, which must use the split with the matching tangent
+	m := Mesh{
+		positions:     []float32{0, 0, 0, 1, 0, 0, 2, 0, 0, 0, 1, 0, 1, 1, 0, 2, 1, 0},
+		normals:       []float32{0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1},
+		textureCoords: []float32{0, 1, 1, 1, 0, 1, 0, 0, 1, 0, 0, 0},
+		indices:       []uint32{0, 1, 4, 0, 4, 3, 1, 2, 5, 1, 5, 4},
+		lods:          []meshLOD{{indices: []uint32{0, 1, 4, 1, 2, 5}}},
+	}
+	lod := Mesh{positions: m.positions, textureCoords: m.textureCoords, indices: m.lods[0].indices}
+	corners := testCorners(&lod)
+	if err := m.GenerateTangents(); err != nil {
+		t.Fatal(err)
+	}
+	lod = Mesh{positions: m.positions, textureCoords: m.textureCoords, indices: m.lods[0].indices}
+	for i, c := range testCorners(&lod) {
+		if c != corners[i] {
+			t.Fatalf("Corner %d of the level changed from %v to %v", i, corners[i], c)
+		}
+		want := float32(1)
+		if i >= 3 {
+			want = -1
+		}
+		if _, sign := testTangent(&m, lod.indices[i]); sign != want {
+			t.Errorf("Corner %d of the level uses a vertex with sign %v, expected %v", i, sign, want)
+		}
+	}
+}
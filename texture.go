@@ -28,6 +28,12 @@ func (t Texture) Unbind(unit int) {
 	gl.BindTexture(gl.TEXTURE_2D, 0)
 }
 
+// Delete deletes the texture
+func (t Texture) Delete() {
+	id := uint32(t)
+	gl.DeleteTextures(1, &id)
+}
+
 // NewTextureFromReader creates a texture from the provided io.Reader
 func NewTextureFromReader(r io.Reader, mipmap bool) (Texture, error) {
 	i, _, err := image.Decode(r)
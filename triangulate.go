@@ -0,0 +1,147 @@
+package main
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// triangulatePolygon splits a planar polygon into triangles and returns them as indices into polygon.
+// Convex polygons are split into a fan, concave polygons are triangulated by ear clipping
+func triangulatePolygon(polygon []mgl32.Vec3) [][3]int {
+	n := len(polygon)
+	if n < 3 {
+		return nil
+	}
+	if n == 3 {
+		return [][3]int{{0, 1, 2}}
+	}
+
+	points := projectPolygon(polygon)
+	orientation := signedArea(points)
+	if orientation == 0 || isConvex(points, orientation) {
+		return fanTriangulation(n)
+	}
+	return earClipping(points, orientation)
+}
+
+// fanTriangulation returns the triangles of a fan around the first vertex of a polygon with n vertices
+func fanTriangulation(n int) [][3]int {
+	triangles := make([][3]int, 0, n-2)
+	for i := 1; i < n-1; i++ {
+		triangles = append(triangles, [3]int{0, i, i + 1})
+	}
+	return triangles
+}
+
+// earClipping triangulates a simple polygon by repeatedly cutting off ears
+func earClipping(points []mgl32.Vec2, orientation float32) [][3]int {
+	remaining := make([]int, len(points))
+	for i := range remaining {
+		remaining[i] = i
+	}
+	triangles := make([][3]int, 0, len(points)-2)
+
+	for len(remaining) > 3 {
+		found := false
+		for i := range remaining {
+			prev := remaining[(i+len(remaining)-1)%len(remaining)]
+			cur := remaining[i]
+			next := remaining[(i+1)%len(remaining)]
+			if !isEar(points, remaining, prev, cur, next, orientation) {
+				continue
+			}
+			triangles = append(triangles, [3]int{prev, cur, next})
+			remaining = append(remaining[:i], remaining[i+1:]...)
+			found = true
+			break
+		}
+		if !found {
+			// The polygon is self-intersecting or degenerate, fall back to a fan over what is left
+			for i := 1; i < len(remaining)-1; i++ {
+				triangles = append(triangles, [3]int{remaining[0], remaining[i], remaining[i+1]})
+			}
+			return triangles
+		}
+	}
+	return append(triangles, [3]int{remaining[0], remaining[1], remaining[2]})
+}
+
+// isEar checks if the corner at cur is convex and no other vertex of the polygon lies inside of it
+func isEar(points []mgl32.Vec2, remaining []int, prev, cur, next int, orientation float32) bool {
+	a, b, c := points[prev], points[cur], points[next]
+	if cross2D(a, b, c)*orientation <= 0 {
+		return false
+	}
+	for _, r := range remaining {
+		if r == prev || r == cur || r == next {
+			continue
+		}
+		if pointInTriangle(points[r], a, b, c, orientation) {
+			return false
+		}
+	}
+	return true
+}
+
+// pointInTriangle checks if p lies inside of or on the border of the triangle abc
+func pointInTriangle(p, a, b, c mgl32.Vec2, orientation float32) bool {
+	return cross2D(a, b, p)*orientation >= 0 &&
+		cross2D(b, c, p)*orientation >= 0 &&
+		cross2D(c, a, p)*orientation >= 0
+}
+
+// isConvex checks if all corners of the polygon turn in the direction given by orientation
+func isConvex(points []mgl32.Vec2, orientation float32) bool {
+	n := len(points)
+	for i := range points {
+		if cross2D(points[(i+n-1)%n], points[i], points[(i+1)%n])*orientation < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// projectPolygon projects a polygon onto the coordinate plane that is closest to its own plane
+func projectPolygon(polygon []mgl32.Vec3) []mgl32.Vec2 {
+	normal := newellNormal(polygon)
+	x, y := 0, 1
+	ax, ay, az := math.Abs(float64(normal.X())), math.Abs(float64(normal.Y())), math.Abs(float64(normal.Z()))
+	if ax >= ay && ax >= az {
+		x, y = 1, 2
+	} else if ay >= az {
+		x, y = 2, 0
+	}
+	points := make([]mgl32.Vec2, len(polygon))
+	for i, p := range polygon {
+		points[i] = mgl32.Vec2{p[x], p[y]}
+	}
+	return points
+}
+
+// newellNormal computes the (unnormalized) normal of a possibly non-planar polygon using Newell's method
+func newellNormal(polygon []mgl32.Vec3) mgl32.Vec3 {
+	var normal mgl32.Vec3
+	for i, cur := range polygon {
+		next := polygon[(i+1)%len(polygon)]
+		normal[0] += (cur.Y() - next.Y()) * (cur.Z() + next.Z())
+		normal[1] += (cur.Z() - next.Z()) * (cur.X() + next.X())
+		normal[2] += (cur.X() - next.X()) * (cur.Y() + next.Y())
+	}
+	return normal
+}
+
+// signedArea returns twice the signed area of a 2D polygon
+func signedArea(points []mgl32.Vec2) float32 {
+	var area float32
+	for i, cur := range points {
+		next := points[(i+1)%len(points)]
+		area += cur.X()*next.Y() - next.X()*cur.Y()
+	}
+	return area
+}
+
+// cross2D returns the z component of the cross product of (b - a) and (c - b)
+func cross2D(a, b, c mgl32.Vec2) float32 {
+	return (b.X()-a.X())*(c.Y()-b.Y()) - (b.Y()-a.Y())*(c.X()-b.X())
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestTriangulatePolygon(t *testing.T) {
+	tests := []struct {
+		name      string
+		polygon   []mgl32.Vec3
+		triangles int
+		area      float32
+	}{
+		{"triangle", []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}, 1, 0.5},
+		{"quad", []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}}, 2, 1},
+		// An L shape in the xz plane, which is not convex and can't be split into a fan
+		{"concave", []mgl32.Vec3{{0, 0, 0}, {0, 0, 2}, {1, 0, 2}, {1, 0, 1}, {2, 0, 1}, {2, 0, 0}}, 4, 3},
+		{"clockwise concave", []mgl32.Vec3{{2, 0, 0}, {2, 0, 1}, {1, 0, 1}, {1, 0, 2}, {0, 0, 2}, {0, 0, 0}}, 4, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			triangles := triangulatePolygon(test.polygon)
+			if len(triangles) != test.triangles {
+				t.Fatalf("%d triangles instead of %d", len(triangles), test.triangles)
+			}
+			// The triangles only cover the polygon exactly if they face the same way as it without overlaps or gaps
+			normal := newellNormal(test.polygon)
+			area := float32(0)
+			for i, triangle := range triangles {
+				a, b, c := test.polygon[triangle[0]], test.polygon[triangle[1]], test.polygon[triangle[2]]
+				cross := b.Sub(a).Cross(c.Sub(a))
+				if cross.Dot(normal) <= 0 {
+					t.Fatalf("Triangle %d %v is flipped or degenerate", i, triangle)
+				}
+				area += cross.Len() / 2
+			}
+			if area != test.area {
+				t.Fatalf("Triangles have an area of %v instead of %v", area, test.area)
+			}
+		})
+	}
+}
@@ -8,3 +8,10 @@ func clampf64(x, min, max float64) float64 {
 	}
 	return x
 }
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// ComponentType is the type of the components of a vertex attribute in a buffer
+type ComponentType uint8
+
+// The component types of vertex attributes. Integer types are converted to floats in the shader,
+// mapped to [0, 1] or [-1, 1] if the attribute is normalized
+const (
+	ComponentFloat32 ComponentType = iota
+	ComponentFloat16
+	ComponentInt8
+	ComponentUint8
+	ComponentInt16
+	ComponentUint16
+)
+
+// VertexAttribute describes where an attribute is stored in the vertices of an interleaved buffer
+type VertexAttribute struct {
+	// Location is the attribute location in the shader
+	Location uint32
+	// Components is the number of components from 1 to 4
+	Components int32
+	Type       ComponentType
+	// Normalized maps integer types to [0, 1] for unsigned and [-1, 1] for signed types
+	Normalized bool
+	// Offset is the offset of the attribute from the start of a vertex in bytes
+	Offset int
+}
+
+// VertexLayout describes the attributes of the vertices in an interleaved buffer
+type VertexLayout struct {
+	attributes []VertexAttribute
+	stride     int
+}
+
+// NewVertexLayout creates a layout from the attributes. The stride is the end of the last attribute rounded up to 4 bytes,
+// which keeps every vertex aligned
+func NewVertexLayout(attributes ...VertexAttribute) VertexLayout {
+	layout := VertexLayout{attributes: append([]VertexAttribute{}, attributes...)}
+	for _, a := range attributes {
+		if end := a.Offset + a.size(); end > layout.stride {
+			layout.stride = end
+		}
+	}
+	layout.stride = (layout.stride + 3) &^ 3
+	return layout
+}
+
+// MeshVertexLayout returns a packed layout for the attributes of the mesh at the locations used by CreateModelFromMesh.
+// Positions and texture coordinates are floats, normals and tangents are normalized shorts and colors normalized bytes.
+// If a material has a bump map, the layout has tangents even if the mesh has none yet, since they are generated when it is uploaded
+func MeshVertexLayout(mesh *Mesh) VertexLayout {
+	vertexCount := len(mesh.positions) / 3
+	attributes := []VertexAttribute{}
+	offset := 0
+	add := func(location uint32, components int32, componentType ComponentType, normalized bool) {
+		a := VertexAttribute{location, components, componentType, normalized, offset}
+		attributes = append(attributes, a)
+		offset = (offset + a.size() + 3) &^ 3
+	}
+	add(positionAttribute, 3, ComponentFloat32, false)
+	if len(mesh.textureCoords) == vertexCount*2 && vertexCount > 0 {
+		add(textureCoordAttribute, 2, ComponentFloat32, false)
+	}
+	if len(mesh.normals) == vertexCount*3 && vertexCount > 0 {
+		add(normalAttribute, 3, ComponentInt16, true)
+	}
+	if len(mesh.colors) == vertexCount*4 && vertexCount > 0 {
+		add(colorAttribute, 4, ComponentUint8, true)
+	}
+	if (len(mesh.tangents) == vertexCount*4 || meshNeedsTangents(mesh)) && vertexCount > 0 {
+		add(tangentAttribute, 4, ComponentInt16, true)
+	}
+	return NewVertexLayout(attributes...)
+}
+
+// Stride returns the size of a vertex in bytes
+func (l VertexLayout) Stride() int {
+	return l.stride
+}
+
+// Attributes returns the attributes of the layout
+func (l VertexLayout) Attributes() []VertexAttribute {
+	return append([]VertexAttribute{}, l.attributes...)
+}
+
+// Interleave packs the data of the attributes into an interleaved buffer. data contains the float components of every
+// attribute in the order of the layout, which are converted to the types of the attributes
+func (l VertexLayout) Interleave(vertexCount int, data ...[]float32) ([]byte, error) {
+	if len(data) != len(l.attributes) {
+		return nil, fmt.Errorf("Expected data for %d attributes, got %d", len(l.attributes), len(data))
+	}
+	buffer := make([]byte, vertexCount*l.stride)
+	for i, a := range l.attributes {
+		components := int(a.Components)
+		if len(data[i]) != vertexCount*components {
+			return nil, fmt.Errorf("Attribute at location %d has %d values instead of %d", a.Location, len(data[i]), vertexCount*components)
+		}
+		componentSize := a.Type.size()
+		for v := 0; v < vertexCount; v++ {
+			for c := 0; c < components; c++ {
+				a.Type.put(buffer[v*l.stride+a.Offset+c*componentSize:], data[i][v*components+c], a.Normalized)
+			}
+		}
+	}
+	return buffer, nil
+}
+
+// checkTangents returns an error if the mesh needs tangents for its bump maps, but the layout has no tangent attribute
+func (l VertexLayout) checkTangents(mesh *Mesh) error {
+	if !meshNeedsTangents(mesh) {
+		return nil
+	}
+	for _, a := range l.attributes {
+		if a.Location == tangentAttribute {
+			return nil
+		}
+	}
+	return errors.New("The bump maps of the mesh need tangents, but the vertex layout has no tangent attribute")
+}
+
+// meshAttributeData returns the data of the mesh for an attribute location used by CreateModelFromMesh
+func meshAttributeData(mesh *Mesh, location uint32) ([]float32, error) {
+	switch location {
+	case positionAttribute:
+		return mesh.positions, nil
+	case textureCoordAttribute:
+		return mesh.textureCoords, nil
+	case normalAttribute:
+		return mesh.normals, nil
+	case colorAttribute:
+		return mesh.colors, nil
+	case tangentAttribute:
+		return mesh.tangents, nil
+	}
+	return nil, fmt.Errorf("No mesh attribute at location %d", location)
+}
+
+// size returns the size of the attribute in bytes
+func (a VertexAttribute) size() int {
+	return int(a.Components) * a.Type.size()
+}
+
+// size returns the size of a component in bytes
+func (t ComponentType) size() int {
+	switch t {
+	case ComponentFloat16, ComponentInt16, ComponentUint16:
+		return 2
+	case ComponentInt8, ComponentUint8:
+		return 1
+	}
+	return 4
+}
+
+// glType returns the OpenGL type of the components
+func (t ComponentType) glType() uint32 {
+	switch t {
+	case ComponentFloat16:
+		return gl.HALF_FLOAT
+	case ComponentInt8:
+		return gl.BYTE
+	case ComponentUint8:
+		return gl.UNSIGNED_BYTE
+	case ComponentInt16:
+		return gl.SHORT
+	case ComponentUint16:
+		return gl.UNSIGNED_SHORT
+	}
+	return gl.FLOAT
+}
+
+// put writes the value as a component of the type to the start of b. Integer values are rounded and clamped to the range of the type
+func (t ComponentType) put(b []byte, value float32, normalized bool) {
+	integer := func(min, max float64) float64 {
+		v := float64(value)
+		if normalized {
+			v = clampf64(v, math.Max(min, -1), 1) * max
+		}
+		return clampf64(math.Round(v), min, max)
+	}
+	switch t {
+	case ComponentFloat32:
+		binary.LittleEndian.PutUint32(b, math.Float32bits(value))
+	case ComponentFloat16:
+		binary.LittleEndian.PutUint16(b, float32ToHalf(value))
+	case ComponentInt8:
+		b[0] = byte(int8(integer(math.MinInt8, math.MaxInt8)))
+	case ComponentUint8:
+		b[0] = uint8(integer(0, math.MaxUint8))
+	case ComponentInt16:
+		binary.LittleEndian.PutUint16(b, uint16(int16(integer(math.MinInt16, math.MaxInt16))))
+	case ComponentUint16:
+		binary.LittleEndian.PutUint16(b, uint16(integer(0, math.MaxUint16)))
+	}
+}
+
+// float32ToHalf converts a float to a half float, rounding to the nearest value. Values that are too large become infinity
+func float32ToHalf(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exponent := int32(bits>>23&0xff) - 127 + 15
+	mantissa := bits & 0x7fffff
+	switch {
+	case bits&0x7fffffff > 0x7f800000:
+		return sign | 0x7e00
+	case exponent >= 31:
+		return sign | 0x7c00
+	case exponent <= 0:
+		// Subnormal half floats have no implicit leading one
+		if exponent < -10 {
+			return sign
+		}
+		mantissa |= 0x800000
+		shift := uint32(14 - exponent)
+		half := mantissa >> shift
+		if mantissa>>(shift-1)&1 != 0 {
+			half++
+		}
+		return sign | uint16(half)
+	}
+	// Rounding may carry into the exponent, which correctly rounds up to the next power of two or infinity
+	half := uint32(exponent)<<10 | mantissa>>13
+	if mantissa&0x1000 != 0 {
+		half++
+	}
+	return sign | uint16(half)
+}
+
+// AddInterleavedBuffer adds a buffer with interleaved vertex data and a vertex attribute for every attribute of the layout
+func (m *Model) AddInterleavedBuffer(layout VertexLayout, data []byte) {
+	gl.BindVertexArray(m.vao)
+	var vbo uint32
+	gl.GenBuffers(1, &vbo)
+	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
+	gl.BufferData(gl.ARRAY_BUFFER, len(data), gl.Ptr(data), gl.STATIC_DRAW)
+	for _, a := range layout.attributes {
+		gl.VertexAttribPointer(a.Location, a.Components, a.Type.glType(), a.Normalized, int32(layout.stride), gl.PtrOffset(a.Offset))
+		m.locations = append(m.locations, a.Location)
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	gl.BindVertexArray(0)
+	m.vbos = append(m.vbos, vbo)
+	m.buffers = append(m.buffers, vertexBuffer{len(data), StaticBuffer, true})
+}
+
+// CreateModelFromMeshWithLayout uploads the mesh like CreateModelFromMesh, but into a single interleaved buffer with the layout.
+// The locations of the layout select the attributes of the mesh, which are the same as for CreateModelFromMesh.
+// If a material has a bump map, the layout needs a tangent attribute, which MeshVertexLayout adds for such meshes
+func CreateModelFromMeshWithLayout(mesh *Mesh, layout VertexLayout) (Model, error) {
+	if err := layout.checkTangents(mesh); err != nil {
+		return Model{}, err
+	}
+	if err := prepareMesh(mesh); err != nil {
+		return Model{}, err
+	}
+	data := make([][]float32, len(layout.attributes))
+	for i, a := range layout.attributes {
+		var err error
+		if data[i], err = meshAttributeData(mesh, a.Location); err != nil {
+			return Model{}, err
+		}
+	}
+	buffer, err := layout.Interleave(len(mesh.positions)/3, data...)
+	if err != nil {
+		return Model{}, err
+	}
+
+	model := NewModel()
+	model.AddInterleavedBuffer(layout, buffer)
+	model.SetIndexBuffer(modelIndices(mesh))
+	model.computeBounds(mesh.positions)
+	model.setMesh(mesh)
+	return model, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestFloat32ToHalf(t *testing.T) {
+	tests := []struct {
+		value float32
+		half  uint16
+	}{
+		{0, 0},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},
+		// Too large values become infinity
+		{1e6, 0x7c00},
+		// The smallest normal and subnormal half floats
+		{6.1035156e-05, 0x0400},
+		{5.960464e-8, 0x0001},
+	}
+	for _, test := range tests {
+		if half := float32ToHalf(test.value); half != test.half {
+			t.Errorf("Expected %#04x for %v, got %#04x", test.half, test.value, half)
+		}
+	}
+	if half := float32ToHalf(float32(math.NaN())); half&0x7c00 != 0x7c00 || half&0x03ff == 0 {
+		t.Errorf("Expected a NaN, got %#04x", half)
+	}
+}
+
+func TestMeshVertexLayout(t *testing.T) {
+	mesh := Mesh{
+		positions:     []float32{1, 2, 3, 4, 5, 6},
+		textureCoords: []float32{0, 0, 1, 1},
+		normals:       []float32{0, 0, 1, 0, -1, 0},
+		colors:        []float32{1, 0, 0.5, 1, 0, 0, 0, 0},
+	}
+	layout := MeshVertexLayout(&mesh)
+	// 12 bytes of positions, 8 of texture coordinates, 6 of normals padded to 8 and 4 of colors
+	if layout.Stride() != 32 || len(layout.Attributes()) != 4 {
+		t.Fatalf("Expected 4 attributes with a stride of 32, got %+v", layout)
+	}
+	data := [][]float32{}
+	for _, a := range layout.Attributes() {
+		d, err := meshAttributeData(&mesh, a.Location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, d)
+	}
+	b, err := layout.Interleave(2, data...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 64 {
+		t.Fatalf("Expected 64 bytes, got %d", len(b))
+	}
+	if z := math.Float32frombits(binary.LittleEndian.Uint32(b[32+8:])); z != 6 {
+		t.Errorf("Expected the z coordinate 6 of the second vertex, got %v", z)
+	}
+	if z, y := int16(binary.LittleEndian.Uint16(b[20+4:])), int16(binary.LittleEndian.Uint16(b[32+20+2:])); z != 32767 || y != -32767 {
+		t.Errorf("Expected normalized normals, got %d and %d", z, y)
+	}
+	if b[28] != 255 || b[29] != 0 || b[30] != 128 || b[31] != 255 {
+		t.Errorf("Expected normalized colors, got %v", b[28:32])
+	}
+	if _, err := layout.Interleave(3, data...); err == nil {
+		t.Error("Expected an error for too little data")
+	}
+	if _, err := layout.Interleave(2, data[:3]...); err == nil {
+		t.Error("Expected an error for a missing attribute")
+	}
+}
+
+func TestVertexLayoutInterleave(t *testing.T) {
+	layout := NewVertexLayout(
+		VertexAttribute{Location: 1, Components: 2, Type: ComponentFloat16},
+		VertexAttribute{Location: 0, Components: 3, Type: ComponentInt8, Offset: 4},
+	)
+	// The stride is rounded up to 4 bytes
+	if layout.Stride() != 8 {
+		t.Fatalf("Expected a stride of 8, got %d", layout.Stride())
+	}
+	b, err := layout.Interleave(1, []float32{1, 0.5}, []float32{-200, 3.4, 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Integers that are not normalized are rounded and clamped
+	if binary.LittleEndian.Uint16(b) != 0x3c00 || binary.LittleEndian.Uint16(b[2:]) != 0x3800 || int8(b[4]) != -128 || b[5] != 3 || b[6] != 100 {
+		t.Errorf("Unexpected vertex %v", b)
+	}
+}
+
+func TestCreateModelFromMeshWithLayoutNeedsTangents(t *testing.T) {
+	mesh := Mesh{positions: []float32{0, 0, 0, 1, 0, 0, 0, 1, 0}, textureCoords: []float32{0, 0, 1, 0, 0, 1},
+		normals: []float32{0, 0, 1, 0, 0, 1, 0, 0, 1}, indices: []uint32{0, 1, 2},
+		parts: []ModelPart{{submeshes: []Submesh{{count: 3, material: &Material{bumpMap: "bump.png"}}}}}}
+	layout := NewVertexLayout(
+		VertexAttribute{positionAttribute, 3, ComponentFloat32, false, 0},
+		VertexAttribute{textureCoordAttribute, 2, ComponentFloat32, false, 12},
+		VertexAttribute{normalAttribute, 3, ComponentInt16, true, 20},
+	)
+	if _, err := CreateModelFromMeshWithLayout(&mesh, layout); err == nil {
+		t.Fatal("Expected an error for a layout without tangents")
+	}
+	if _, err := (&MeshPool{layout: layout}).Add(&mesh); err == nil {
+		t.Fatal("Expected an error for a pool without tangents")
+	}
+}
+
+func TestMeshVertexLayoutBumpMap(t *testing.T) {
+	mesh := Mesh{positions: []float32{0, 0, 0, 1, 0, 0, 0, 1, 0}, textureCoords: []float32{0, 0, 1, 0, 0, 1},
+		normals: []float32{0, 0, 1, 0, 0, 1, 0, 0, 1}, indices: []uint32{0, 1, 2},
+		parts: []ModelPart{{submeshes: []Submesh{{count: 3, material: &Material{bumpMap: "bump.png"}}}}}}
+	// The default layout of a mesh with a bump map has tangents before they are generated
+	layout := MeshVertexLayout(&mesh)
+	if err := layout.checkTangents(&mesh); err != nil {
+		t.Fatal(err)
+	}
+	if err := mesh.GenerateTangents(); err != nil {
+		t.Fatal(err)
+	}
+	data := [][]float32{}
+	for _, a := range layout.Attributes() {
+		d, err := meshAttributeData(&mesh, a.Location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, d)
+	}
+	if _, err := layout.Interleave(len(mesh.positions)/3, data...); err != nil {
+		t.Fatal(err)
+	}
+	if MeshVertexLayout(&mesh).Stride() != layout.Stride() {
+		t.Error("The layout changed after the tangents were generated")
+	}
+}